@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"kasm-stress-test/internal/api"
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/utils"
+)
+
+// runCleanup implements "kasm-stress-test cleanup [flags]", which destroys
+// the sessions the test users have on the deployment, e.g. after a run was
+// killed before its teardown. Only the sessions of the users given with -u or
+// in the config are touched. It returns the process exit code: 0 when every
+// session was destroyed, 1 when some weren't and 2 on errors.
+func runCleanup(args []string) int {
+	fs := newFlagSet("cleanup", "cleanup [flags]", "Destroys the sessions the test users have on the deployment, after listing them and asking for confirmation.")
+	flags := newAPIFlags(fs)
+	var dryRun, yes bool
+	fs.BoolVar(&dryRun, "dry-run", false, "List the sessions that would be destroyed without destroying them")
+	fs.BoolVar(&yes, "y", false, "Destroy the sessions without asking for confirmation")
+	fs.BoolVar(&yes, "yes", false, "Destroy the sessions without asking for confirmation")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	cfg, err := connect(flags, "default_image_id")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer utils.CloseLogFile()
+	if len(cfg.Usernames()) == 0 {
+		fmt.Fprintln(os.Stderr, "At least one username is required, give it with -u or set users or groups in the config")
+		return 2
+	}
+
+	client := api.NewClient(cfg)
+	var users []*models.User
+	for _, username := range cfg.Usernames() {
+		user, err := lookupUser(client, username)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		users = append(users, user)
+	}
+	kasms, err := client.GetKasms(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var leftover []models.KasmInfo
+	for _, kasm := range kasms {
+		for _, user := range users {
+			if ownedBy(kasm, user) {
+				kasm.User.Username = user.Username
+				leftover = append(leftover, kasm)
+				break
+			}
+		}
+	}
+	if len(leftover) == 0 {
+		fmt.Println("The test users have no sessions on the deployment")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KASM ID\tUSER\tIMAGE\tSTATUS\tSTARTED")
+	for _, kasm := range leftover {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", kasm.KasmID, kasm.User.Username, kasm.ImageID, kasm.OperationalStatus, kasm.StartDate)
+	}
+	w.Flush()
+
+	if dryRun {
+		fmt.Printf("\n%d sessions would be destroyed\n", len(leftover))
+		return 0
+	}
+	if !yes {
+		fmt.Printf("\nDestroy these %d sessions? [y/N] ", len(leftover))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Println("Nothing was destroyed")
+			return 0
+		}
+	}
+
+	// Sessions are destroyed by as many workers as a run's teardown uses
+	failed := destroySessions(client, leftover, cfg.TeardownWorkers)
+	fmt.Printf("Destroyed %d of %d sessions\n", len(leftover)-failed, len(leftover))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// destroySessions destroys kasms with the given number of workers and
+// returns how many couldn't be destroyed
+func destroySessions(client *api.Client, kasms []models.KasmInfo, workers int) int {
+	if workers < 1 {
+		workers = 1
+	}
+	queue := make(chan models.KasmInfo)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures int
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for kasm := range queue {
+				err := client.DestroyKasm(context.Background(), kasm.KasmID, kasm.UserID)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to destroy Kasm %s of %s: %v\n", kasm.KasmID, kasm.User.Username, utils.Redact(err.Error()))
+					mu.Lock()
+					failures++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, kasm := range kasms {
+		queue <- kasm
+	}
+	close(queue)
+	wg.Wait()
+	return failures
+}
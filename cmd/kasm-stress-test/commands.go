@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"kasm-stress-test/internal/api"
+	"kasm-stress-test/internal/config"
+	"kasm-stress-test/internal/utils"
+)
+
+// command is a subcommand of the tool. run takes the arguments after the
+// command name and returns the process exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands are the subcommands of the tool, in the order they are listed in
+// the help
+var commands = []command{
+	{"run", "Run a stress test (the default when no command is given)", runTest},
+	{"preflight", "Check that a run could start: config, credentials, users and image", runPreflight},
+	{"cleanup", "Destroy sessions the test users left on the deployment", runCleanup},
+	{"images", "List the images on the deployment", runImages},
+	{"users", "Show the test users and how many sessions they have", runUsers},
+	{"report", "Summarise a result file, write it as other reports and check thresholds", runReport},
+	{"compare", "Compare two result files and report regressions", runCompare},
+	{"config", "Show the effective config and where each value was set", runConfig},
+	{"version", "Print the version", runVersion},
+}
+
+func main() {
+	os.Exit(dispatch(os.Args[1:]))
+}
+
+// dispatch runs the command named by the first argument and returns its exit
+// code. Without a command, or when the first argument is a flag, the
+// arguments are those of a run, as they were before there were commands.
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		return runTest(args)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			if cmd, ok := findCommand(args[1]); ok {
+				return cmd.run([]string{"-h"})
+			}
+		}
+		printUsage(os.Stdout)
+		return 0
+	case "-version", "--version":
+		return runVersion(nil)
+	}
+	if strings.HasPrefix(args[0], "-") {
+		return runTest(args)
+	}
+
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		printUsage(os.Stderr)
+		return 2
+	}
+	return cmd.run(args[1:])
+}
+
+// findCommand returns the command with the given name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// printUsage lists the commands
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: kasm-stress-test <command> [flags]\n\nCommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nWithout a command the flags are those of run, e.g. kasm-stress-test -u alice -n 5.\n")
+	fmt.Fprintf(w, "Run 'kasm-stress-test help <command>' for the flags of a command.\n")
+}
+
+// newFlagSet creates the flag set of a command, whose help starts with the
+// command's usage and a description of what it does
+func newFlagSet(name, usage, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kasm-stress-test %s\n\n%s\n\n", usage, description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses the arguments of a command. If they couldn't be parsed
+// it returns false and the exit code to stop with: 0 when help was asked for,
+// 2 otherwise.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0, false
+		}
+		return 2, false
+	}
+	return 0, true
+}
+
+// connect loads the config of a command that calls the API and sets up the
+// API client. Problems with the unused settings are ignored, so e.g. images
+// can be listed before a default image is chosen.
+func connect(flags *runFlags, unused ...string) (*config.Config, error) {
+	cfg, err := config.Resolve(flags.loadOptions(), flags.apply)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		var validationErr *config.ValidationError
+		if !errors.As(err, &validationErr) {
+			return nil, err
+		}
+		if err := validationErr.Without(unused...); err != nil {
+			return nil, err
+		}
+	}
+	if err := utils.InitLoggers(cfg.LogOptions()); err != nil {
+		return nil, fmt.Errorf("failed to initialize loggers: %w", err)
+	}
+
+	if err := api.InitTransport(cfg); err != nil {
+		return nil, fmt.Errorf("failed to set up the API client: %w", err)
+	}
+	if cfg.TLSInsecureSkipVerify {
+		fmt.Fprintln(os.Stderr, "WARNING: TLS certificate verification is disabled (tls_insecure_skip_verify).")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"kasm-stress-test/internal/compare"
+	"kasm-stress-test/internal/report"
+)
+
+// runCompare implements "kasm-stress-test compare old.json new.json" and
+// returns the process exit code: 0 when there are no regressions, 1 when
+// there are and 2 on errors
+func runCompare(args []string) int {
+	fs := newFlagSet("compare", "compare [flags] baseline.json new.json", "Compares two result files written with --report json=path.")
+
+	opts := compare.DefaultOptions
+	fs.Float64Var(&opts.Alpha, "alpha", opts.Alpha, "Significance level a difference must reach to count as a regression")
+	fs.Float64Var(&opts.MinChange, "min-change", opts.MinChange, "Smallest relative increase of the median time to running reported as a regression, e.g. 0.1 for 10%")
+
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	oldRun, err := report.ReadJSON(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	newRun, err := report.ReadJSON(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	comparison := compare.Runs(oldRun, newRun, opts)
+	if err := comparison.Write(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(comparison.Regressions) > 0 {
+		return 1
+	}
+	return 0
+}
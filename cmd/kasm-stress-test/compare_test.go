@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kasm-stress-test/internal/models"
+)
+
+// writeRun writes a result file with a successful session per start time,
+// in seconds, and returns its path
+func writeRun(t *testing.T, name string, startTimes ...float64) string {
+	t.Helper()
+	result := &models.StressTestResult{}
+	for _, startTime := range startTimes {
+		result.KasmResults = append(result.KasmResults, models.KasmResult{
+			ImageID:   "img1",
+			StartTime: time.Duration(startTime * float64(time.Second)),
+		})
+	}
+	data, err := json.Marshal(&models.RunResult{RunID: name, Results: []*models.StressTestResult{result}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name+".json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunCompareExitCode(t *testing.T) {
+	baseline := writeRun(t, "baseline", 10, 11, 12, 13, 14, 15, 16, 17, 18, 19)
+	unchanged := writeRun(t, "unchanged", 10, 11, 12, 13, 14, 15, 16, 17, 18, 19)
+	slower := writeRun(t, "slower", 20, 21, 22, 23, 24, 25, 26, 27, 28, 29)
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "no regressions", args: []string{baseline, unchanged}, want: 0},
+		{name: "regressions", args: []string{baseline, slower}, want: 1},
+		{name: "below min change", args: []string{"--min-change", "2", baseline, slower}, want: 0},
+		{name: "missing file", args: []string{baseline, filepath.Join(t.TempDir(), "missing.json")}, want: 2},
+		{name: "invalid file", args: []string{invalid, baseline}, want: 2},
+		{name: "one file", args: []string{baseline}, want: 2},
+		{name: "unknown flag", args: []string{"--beta", "0.1", baseline, slower}, want: 2},
+		{name: "help", args: []string{"--help"}, want: 0},
+	}
+	// The comparison and usage are printed, not checked
+	stdout, stderr := os.Stdout, os.Stderr
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Stdout, os.Stderr = devNull, devNull
+			got := runCompare(tt.args)
+			os.Stdout, os.Stderr = stdout, stderr
+			if got != tt.want {
+				t.Errorf("runCompare(%q) = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
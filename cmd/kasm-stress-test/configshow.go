@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"kasm-stress-test/internal/config"
+	"kasm-stress-test/internal/utils"
+)
+
+// runConfig implements "kasm-stress-test config show [flags]", which prints
+// the effective config with secrets masked and the source of each value. It
+// takes the same flags as a run, so their effect can be checked. It returns
+// the process exit code: 0 when the config is valid, 1 when it isn't and 2
+// on errors.
+func runConfig(args []string) int {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		args = []string{"show", "-h"}
+	}
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintf(os.Stderr, "Usage: kasm-stress-test config show [flags]\n")
+		return 2
+	}
+
+	fs := newFlagSet("config show", "config show [flags]", "Prints the effective config and where each value was set, taking the same flags as a run.")
+	flags := newRunFlags(fs)
+	if code, ok := parseFlags(fs, args[1:]); !ok {
+		return code
+	}
+
+	cfg, err := config.Resolve(flags.loadOptions(), flags.apply)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if cfg.Path != "" {
+		fmt.Printf("Config file: %s\n", cfg.Path)
+	} else {
+		fmt.Printf("Config file: none\n")
+	}
+	if cfg.Profile != "" {
+		fmt.Printf("Profile: %s\n", cfg.Profile)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	for _, setting := range cfg.Settings() {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Name, formatSetting(setting), utils.Redact(setting.Source))
+	}
+	w.Flush()
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("\nThe config is invalid: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// formatSetting formats a setting's value for display, masking secrets
+func formatSetting(setting config.Setting) string {
+	switch value := setting.Value.(type) {
+	case string:
+		if setting.Secret {
+			return config.Mask(value)
+		}
+		return value
+	case []string:
+		return strings.Join(value, ", ")
+	case []config.Group:
+		groups := make([]string, 0, len(value))
+		for _, group := range value {
+			groups = append(groups, fmt.Sprintf("%s: %s", group.Name, strings.Join(group.Users, " ")))
+		}
+		return strings.Join(groups, "; ")
+	case map[string]int:
+		pairs := make([]string, 0, len(value))
+		for key, n := range value {
+			pairs = append(pairs, fmt.Sprintf("%s=%d", key, n))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ", ")
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kasm-stress-test/internal/config"
+	"kasm-stress-test/internal/utils"
+)
+
+// runFlags are the command-line flags of a stress test run. Apart from the
+// config file and profile, they override the config. Commands that only call
+// the API define the subset created by newAPIFlags, and apply ignores the
+// flags that weren't defined.
+type runFlags struct {
+	fs *flag.FlagSet
+
+	configPath string
+	profile    string
+
+	logLevel, logFormat string
+	logDir, logFile     string
+	logPerRun           bool
+
+	usernames     utils.StringSliceFlag
+	sessions      int
+	command       string
+	metricsListen string
+	influxTarget  string
+	traceTarget   string
+	deployment    string
+	reports       utils.StringSliceFlag
+	thresholds    utils.StringSliceFlag
+
+	caFile, certFile, keyFile string
+	insecureSkipVerify        bool
+	proxy                     string
+	maxIdleConnsPerHost       int
+	httpKeepAlive             bool
+	endpointTimeouts          endpointTimeoutsFlag
+
+	abortConsecutiveFailures, abortErrorRateWindow, abortStuckRequested int
+	abortErrorRate                                                      float64
+
+	pollMode                                           string
+	pollInterval, pollInitialInterval, pollMaxInterval time.Duration
+	pollBackoff                                        float64
+	readyTimeout, requestedLimit                       time.Duration
+
+	teardownWorkers                 int
+	teardownOrder                   string
+	teardownProfile                 string
+	teardownDuration, teardownPause time.Duration
+	teardownSteps                   int
+	teardownStepPercent             float64
+
+	verifyDestroy  bool
+	destroyTimeout time.Duration
+
+	keepalive                          bool
+	keepaliveInterval, keepaliveMargin time.Duration
+
+	reconcileInterval time.Duration
+
+	soakDuration, workloadInterval, sampleInterval time.Duration
+	churnPerHour                                   float64
+}
+
+// newAPIFlags defines the flags that select the config, the users and how
+// the API is reached on fs. They are shared by every command that calls the
+// API.
+func newAPIFlags(fs *flag.FlagSet) *runFlags {
+	f := &runFlags{fs: fs}
+
+	fs.StringVar(&f.configPath, "config", "", "Config file to load, JSON or YAML (defaults to KASM_CONFIG or ~/.kasm-stress-test.json, .yaml or .yml)")
+	fs.StringVar(&f.profile, "profile", "", "Named profile to load from the config file, e.g. 'staging' (defaults to KASM_PROFILE or the file's default_profile)")
+
+	fs.StringVar(&f.logLevel, "log-level", "", "Lowest level written to the log: 'debug', 'info', 'warn' or 'error' (overrides config)")
+	fs.StringVar(&f.logFormat, "log-format", "", "Format of the log's lines: 'text' or 'json' (overrides config)")
+	fs.StringVar(&f.logDir, "log-dir", "", "Directory of the log files (overrides config, defaults to the executable's directory)")
+	fs.StringVar(&f.logFile, "log-file", "", "Log file, relative to the log directory, or 'stderr' to log to standard error only (overrides config)")
+	fs.BoolVar(&f.logPerRun, "log-per-run", false, "Write each run to its own log file named by its run ID (overrides config)")
+
+	fs.Var(&f.usernames, "u", "Username to use (can be specified multiple times)")
+	fs.Var(&f.usernames, "username", "Username to use (can be specified multiple times)")
+
+	fs.StringVar(&f.caFile, "ca-file", "", "PEM CA bundle to trust in addition to the system roots, for self-signed or internal CA certificates (overrides config)")
+	fs.StringVar(&f.certFile, "cert-file", "", "PEM client certificate to present to the API, used with --key-file (overrides config)")
+	fs.StringVar(&f.keyFile, "key-file", "", "PEM private key of the client certificate (overrides config)")
+	fs.BoolVar(&f.insecureSkipVerify, "insecure-skip-verify", false, "Don't verify the API's TLS certificate; insecure, for lab deployments only (overrides config)")
+	fs.StringVar(&f.proxy, "proxy", "", "Proxy URL for API requests, or 'direct' to bypass HTTP_PROXY and HTTPS_PROXY (overrides config)")
+	fs.IntVar(&f.maxIdleConnsPerHost, "max-idle-conns-per-host", 0, "Idle API connections kept open for reuse (overrides config)")
+	fs.BoolVar(&f.httpKeepAlive, "http-keep-alive", true, "Reuse API connections between requests (overrides config)")
+	fs.Var(&f.endpointTimeouts, "endpoint-timeout", "Timeout of one API endpoint as endpoint=duration, e.g. 'request_kasm=5m' (can be specified multiple times, merged into the config's endpoint timeouts)")
+
+	return f
+}
+
+// newRunFlags defines the flags of a stress test run on fs
+func newRunFlags(fs *flag.FlagSet) *runFlags {
+	f := newAPIFlags(fs)
+
+	fs.IntVar(&f.sessions, "n", 0, "Number of Kasm Sessions to start for each username specified")
+	fs.IntVar(&f.sessions, "number", 0, "Number of Kasm Sessions to start for each username specified")
+
+	fs.StringVar(&f.command, "c", "all", "Command to run: 'cpu', 'network', or 'all' (default)")
+	fs.StringVar(&f.command, "command", "all", "Command to run: 'cpu', 'network', or 'all' (default)")
+
+	fs.StringVar(&f.metricsListen, "metrics-listen", "", "Address to serve Prometheus metrics on, e.g. ':9099' (disabled by default)")
+	fs.StringVar(&f.influxTarget, "influx", "", "Write InfluxDB line protocol events to a file or an HTTP write URL, e.g. 'http://localhost:8086/write?db=kasm'")
+	fs.StringVar(&f.traceTarget, "trace", "", "Export OpenTelemetry spans to an OTLP/HTTP endpoint, e.g. 'http://localhost:4318', or to a JSON file")
+	fs.StringVar(&f.deployment, "deployment", "", "Deployment name to tag results with (defaults to the API host name)")
+	fs.Var(&f.reports, "report", "Write a report as format=path, where format is csv, junit, html or json (can be specified multiple times, replaces reports in the config file)")
+	fs.Var(&f.thresholds, "threshold", "Pass/fail threshold such as 'success_rate>=99' or 'p95_time_to_running<=90s' (can be specified multiple times, replaces thresholds in the config file)")
+
+	fs.IntVar(&f.abortConsecutiveFailures, "abort-consecutive-failures", 0, "Abort the run after this many consecutive failed sessions, 0 to disable (overrides config)")
+	fs.Float64Var(&f.abortErrorRate, "abort-error-rate", 0, "Abort the run when this percentage of the last --abort-error-rate-window sessions failed, 0 to disable (overrides config)")
+	fs.IntVar(&f.abortErrorRateWindow, "abort-error-rate-window", 0, "Number of recent sessions the abort error rate is measured over (overrides config)")
+	fs.IntVar(&f.abortStuckRequested, "abort-stuck-requested", 0, "Abort the run after this many sessions got stuck in the requested state, 0 to disable (overrides config)")
+
+	fs.StringVar(&f.pollMode, "poll-mode", "", "Status polling mode: 'fixed' or 'adaptive' (overrides config)")
+	fs.DurationVar(&f.pollInterval, "poll-interval", 0, "Interval between status polls in fixed mode, e.g. 30s (overrides config)")
+	fs.DurationVar(&f.pollInitialInterval, "poll-initial-interval", 0, "First interval between status polls in adaptive mode, e.g. 1s (overrides config)")
+	fs.DurationVar(&f.pollMaxInterval, "poll-max-interval", 0, "Largest interval between status polls in adaptive mode (overrides config)")
+	fs.Float64Var(&f.pollBackoff, "poll-backoff", 0, "Factor the poll interval grows by after each poll in adaptive mode (overrides config)")
+	fs.DurationVar(&f.readyTimeout, "ready-timeout", 0, "Overall time to wait for a Kasm to be running, e.g. 10m (overrides config)")
+	fs.DurationVar(&f.requestedLimit, "requested-limit", 0, "Time a Kasm may stay in the requested state before it is recreated (overrides config)")
+
+	fs.IntVar(&f.teardownWorkers, "teardown-workers", 0, "Number of sessions to destroy concurrently (overrides config)")
+	fs.StringVar(&f.teardownOrder, "teardown-order", "", "Order to destroy sessions in: 'fifo', 'lifo', 'random' or 'agent' (overrides config)")
+	fs.StringVar(&f.teardownProfile, "teardown-profile", "", "Pace teardown: 'burst', 'ramp', 'step' or 'percent' (overrides config)")
+	fs.DurationVar(&f.teardownDuration, "teardown-duration", 0, "Time the ramp and step teardown profiles spread teardown over, e.g. 10m (overrides config)")
+	fs.IntVar(&f.teardownSteps, "teardown-steps", 0, "Number of steps in the step teardown profile (overrides config)")
+	fs.Float64Var(&f.teardownStepPercent, "teardown-step-percent", 0, "Percentage of sessions destroyed per step in the percent teardown profile (overrides config)")
+	fs.DurationVar(&f.teardownPause, "teardown-pause", 0, "Pause between steps in the percent teardown profile, e.g. 2m (overrides config)")
+
+	fs.BoolVar(&f.verifyDestroy, "verify-destroy", false, "Poll destroyed sessions until they are gone and record their time to destroyed (overrides config)")
+	fs.DurationVar(&f.destroyTimeout, "destroy-timeout", 0, "How long to wait for destroyed sessions to disappear, e.g. 5m (overrides config)")
+
+	fs.BoolVar(&f.keepalive, "keepalive", true, "Keep running sessions alive until they are destroyed (overrides config)")
+	fs.DurationVar(&f.keepaliveInterval, "keepalive-interval", 0, "How often to check whether sessions need a keepalive, e.g. 1m (overrides config)")
+	fs.DurationVar(&f.keepaliveMargin, "keepalive-margin", 0, "Send a keepalive to sessions expiring within this long, e.g. 5m (overrides config)")
+
+	fs.DurationVar(&f.reconcileInterval, "reconcile-interval", 0, "How often to check that running sessions are still on the deployment, e.g. 1m, 0 to disable (overrides config)")
+
+	fs.DurationVar(&f.soakDuration, "soak", 0, "Run a soak test, keeping -n sessions per user live for this long, e.g. 8h (overrides config)")
+	fs.Float64Var(&f.churnPerHour, "churn-per-hour", 0, "Sessions per user destroyed and replaced every hour during a soak test (overrides config)")
+	fs.DurationVar(&f.workloadInterval, "workload-interval", 0, "Rerun the command on every live session this often during a soak test, e.g. 15m (overrides config)")
+	fs.DurationVar(&f.sampleInterval, "sample-interval", 0, "Interval between soak time-series samples, e.g. 5m (overrides config)")
+
+	return f
+}
+
+// loadOptions selects the config file and profile given on the command line
+func (f *runFlags) loadOptions() config.Options {
+	return config.Options{Path: f.configPath, Profile: f.profile}
+}
+
+// isSet reports whether any of the named flags was given on the command line
+func (f *runFlags) isSet(names ...string) bool {
+	set := false
+	f.fs.Visit(func(fl *flag.Flag) {
+		for _, name := range names {
+			if fl.Name == name {
+				set = true
+			}
+		}
+	})
+	return set
+}
+
+// apply overrides the config with the flags given on the command line
+func (f *runFlags) apply(c *config.Config) {
+	if f.logLevel != "" {
+		c.LogLevel = f.logLevel
+	}
+	if f.logFormat != "" {
+		c.LogFormat = f.logFormat
+	}
+	if f.logDir != "" {
+		c.LogDir = f.logDir
+	}
+	if f.logFile != "" {
+		c.LogFile = f.logFile
+	}
+	if f.isSet("log-per-run") {
+		c.LogPerRun = f.logPerRun
+	}
+	if len(f.usernames) > 0 {
+		// Users given on the command line are run on their own
+		c.Users = f.usernames
+		c.Groups = nil
+	}
+	if f.isSet("n", "number") {
+		c.Sessions = f.sessions
+	}
+	if f.isSet("c", "command") {
+		c.Command = f.command
+	}
+	if f.metricsListen != "" {
+		c.MetricsListen = f.metricsListen
+	}
+	if f.influxTarget != "" {
+		c.Influx = f.influxTarget
+	}
+	if f.traceTarget != "" {
+		c.Trace = f.traceTarget
+	}
+	if f.deployment != "" {
+		c.Deployment = f.deployment
+	}
+	if len(f.reports) > 0 {
+		c.Reports = f.reports
+	}
+	if len(f.thresholds) > 0 {
+		c.Thresholds = f.thresholds
+	}
+	if f.caFile != "" {
+		c.TLSCAFile = f.caFile
+	}
+	if f.certFile != "" {
+		c.TLSCertFile = f.certFile
+	}
+	if f.keyFile != "" {
+		c.TLSKeyFile = f.keyFile
+	}
+	if f.isSet("insecure-skip-verify") {
+		c.TLSInsecureSkipVerify = f.insecureSkipVerify
+	}
+	if f.proxy != "" {
+		c.HTTPProxy = f.proxy
+	}
+	if f.maxIdleConnsPerHost > 0 {
+		c.HTTPMaxIdleConnsPerHost = f.maxIdleConnsPerHost
+	}
+	if f.isSet("http-keep-alive") {
+		c.HTTPKeepAlive = f.httpKeepAlive
+	}
+	if len(f.endpointTimeouts) > 0 {
+		// Copy the map rather than adding to it, so the config can tell
+		// it was changed
+		timeouts := make(map[string]int)
+		for endpoint, seconds := range c.EndpointTimeoutsSeconds {
+			timeouts[endpoint] = seconds
+		}
+		for endpoint, seconds := range f.endpointTimeouts {
+			timeouts[endpoint] = seconds
+		}
+		c.EndpointTimeoutsSeconds = timeouts
+	}
+	if f.pollMode != "" {
+		c.PollMode = f.pollMode
+	}
+	if f.pollInterval > 0 {
+		c.PollIntervalSeconds = f.pollInterval.Seconds()
+	}
+	if f.pollInitialInterval > 0 {
+		c.PollInitialIntervalSeconds = f.pollInitialInterval.Seconds()
+	}
+	if f.pollMaxInterval > 0 {
+		c.PollMaxIntervalSeconds = f.pollMaxInterval.Seconds()
+	}
+	if f.pollBackoff > 0 {
+		c.PollBackoff = f.pollBackoff
+	}
+	if f.readyTimeout > 0 {
+		c.ReadyTimeoutSeconds = int(f.readyTimeout.Seconds())
+	}
+	if f.requestedLimit > 0 {
+		c.RequestedLimitSeconds = int(f.requestedLimit.Seconds())
+	}
+	if f.isSet("abort-consecutive-failures") {
+		c.AbortConsecutiveFailures = f.abortConsecutiveFailures
+	}
+	if f.isSet("abort-error-rate") {
+		c.AbortErrorRate = f.abortErrorRate
+	}
+	if f.isSet("abort-error-rate-window") {
+		c.AbortErrorRateWindow = f.abortErrorRateWindow
+	}
+	if f.isSet("abort-stuck-requested") {
+		c.AbortStuckRequested = f.abortStuckRequested
+	}
+	if f.teardownWorkers > 0 {
+		c.TeardownWorkers = f.teardownWorkers
+	}
+	if f.teardownOrder != "" {
+		c.TeardownOrder = f.teardownOrder
+	}
+	if f.teardownProfile != "" {
+		c.TeardownProfile = f.teardownProfile
+	}
+	if f.teardownDuration > 0 {
+		c.TeardownDurationSeconds = int(f.teardownDuration.Seconds())
+	}
+	if f.teardownSteps > 0 {
+		c.TeardownSteps = f.teardownSteps
+	}
+	if f.teardownStepPercent > 0 {
+		c.TeardownStepPercent = f.teardownStepPercent
+	}
+	if f.isSet("teardown-pause") {
+		c.TeardownPauseSeconds = int(f.teardownPause.Seconds())
+	}
+	if f.isSet("verify-destroy") {
+		c.VerifyDestroy = f.verifyDestroy
+	}
+	if f.destroyTimeout > 0 {
+		c.DestroyTimeoutSeconds = int(f.destroyTimeout.Seconds())
+	}
+	if f.isSet("keepalive") {
+		c.Keepalive = f.keepalive
+	}
+	if f.keepaliveInterval > 0 {
+		c.KeepaliveIntervalSeconds = int(f.keepaliveInterval.Seconds())
+	}
+	if f.keepaliveMargin > 0 {
+		c.KeepaliveMarginSeconds = int(f.keepaliveMargin.Seconds())
+	}
+	if f.isSet("reconcile-interval") {
+		c.ReconcileIntervalSeconds = int(f.reconcileInterval.Seconds())
+	}
+	if f.soakDuration > 0 {
+		c.SoakDurationSeconds = int(f.soakDuration.Seconds())
+	}
+	if f.isSet("churn-per-hour") {
+		c.SoakChurnPerHour = f.churnPerHour
+	}
+	if f.isSet("workload-interval") {
+		c.SoakWorkloadIntervalSeconds = int(f.workloadInterval.Seconds())
+	}
+	if f.sampleInterval > 0 {
+		c.SoakSampleIntervalSeconds = int(f.sampleInterval.Seconds())
+	}
+}
+
+// endpointTimeoutsFlag collects endpoint=duration flags as timeouts in
+// seconds by endpoint
+type endpointTimeoutsFlag map[string]int
+
+// String returns the timeouts as sorted endpoint=seconds pairs
+func (e *endpointTimeoutsFlag) String() string {
+	var pairs []string
+	for endpoint, seconds := range *e {
+		pairs = append(pairs, fmt.Sprintf("%s=%ds", endpoint, seconds))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+// Set parses an endpoint=duration pair. The duration may also be a whole
+// number of seconds.
+func (e *endpointTimeoutsFlag) Set(value string) error {
+	endpoint, timeout, ok := strings.Cut(value, "=")
+	if !ok || endpoint == "" {
+		return fmt.Errorf("%q is not an endpoint=duration pair", value)
+	}
+	var seconds int
+	if n, err := strconv.Atoi(timeout); err == nil {
+		seconds = n
+	} else if d, err := time.ParseDuration(timeout); err == nil {
+		seconds = int(d.Seconds())
+	} else {
+		return fmt.Errorf("%q is not a duration", timeout)
+	}
+	if *e == nil {
+		*e = make(endpointTimeoutsFlag)
+	}
+	(*e)[endpoint] = seconds
+	return nil
+}
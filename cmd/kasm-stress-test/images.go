@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"kasm-stress-test/internal/api"
+	"kasm-stress-test/internal/utils"
+)
+
+// runImages implements "kasm-stress-test images [flags]", which lists the
+// images on the deployment so a default_image_id can be chosen. It returns
+// the process exit code: 0 on success and 2 on errors.
+func runImages(args []string) int {
+	fs := newFlagSet("images", "images [flags]", "Lists the images on the deployment, marking the configured default image.")
+	flags := newAPIFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	cfg, err := connect(flags, "default_image_id")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer utils.CloseLogFile()
+
+	images, err := api.NewClient(cfg).GetUserImages(context.Background(), "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(images) == 0 {
+		fmt.Println("There are no images on the deployment")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE ID\tNAME\tDEFAULT")
+	for _, image := range images {
+		isDefault := ""
+		if image.ImageID == cfg.DefaultImageID {
+			isDefault = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", image.ImageID, image.FriendlyName, isDefault)
+	}
+	w.Flush()
+	return 0
+}
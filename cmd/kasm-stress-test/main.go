@@ -2,18 +2,31 @@ package main
 
 import (
 	"bufio"
-	"flag"
+	"context"
 	"fmt"
-	"kasm-stress-test/internal/config"
-	"kasm-stress-test/internal/models"
-	"kasm-stress-test/internal/stress"
-	"kasm-stress-test/internal/utils"
+	"io"
 	"log"
+	"net/url"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
+
+	"kasm-stress-test/internal/api"
+	"kasm-stress-test/internal/config"
+	"kasm-stress-test/internal/metrics"
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/report"
+	"kasm-stress-test/internal/sink"
+	"kasm-stress-test/internal/slo"
+	"kasm-stress-test/internal/stats"
+	"kasm-stress-test/internal/stress"
+	"kasm-stress-test/internal/tracing"
+	"kasm-stress-test/internal/utils"
 )
 
 type SessionStatus struct {
@@ -57,6 +70,213 @@ func updateSessionStatus(username string, sessionNumber int, status string, dura
 		sessionStatuses[username] = append(sessionStatuses[username], SessionStatus{})
 	}
 	sessionStatuses[username][sessionNumber] = SessionStatus{Status: status, Duration: duration}
+	metrics.SetSessionState(username, sessionNumber, status)
+}
+
+// reconcileSessions periodically lists the sessions on the deployment and
+// records running sessions that have vanished until stopChan is closed or ctx
+// is done
+func reconcileSessions(ctx context.Context, client *api.Client, interval time.Duration, stopChan <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopChan:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		// Sessions started while the list is fetched aren't in it
+		listedAt := time.Now()
+		kasms, err := client.GetKasms(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			utils.Error("Failed to list sessions: %v", err)
+			continue
+		}
+		present := stress.KasmIDs(kasms)
+		resultsMutex.Lock()
+		runners := append([]*stress.Runner(nil), allRunners...)
+		resultsMutex.Unlock()
+		for _, runner := range runners {
+			runner.Reconcile(present, listedAt)
+		}
+	}
+}
+
+// printTimeToDestroyed summarises how long destroyed sessions took to
+// disappear
+func printTimeToDestroyed(results []*models.StressTestResult) {
+	var durations []float64
+	stillPresent := 0
+	for _, result := range results {
+		for _, kasmResult := range result.KasmResults {
+			if kasmResult.TimeToDestroyed > 0 {
+				durations = append(durations, kasmResult.TimeToDestroyed.Seconds())
+			}
+			if kasmResult.StillPresent {
+				stillPresent++
+			}
+		}
+	}
+
+	utils.Console("\n--- Time to Destroyed ---\n")
+	if len(durations) > 0 {
+		utils.Console("Sessions verified gone: %d\n", len(durations))
+		utils.Console("Mean: %.1fs, p50: %.1fs, p95: %.1fs, max: %.1fs\n",
+			stats.Mean(durations), stats.Percentile(durations, 50),
+			stats.Percentile(durations, 95), stats.Percentile(durations, 100))
+	}
+	utils.Console("Sessions still present at the destroy timeout: %d\n", stillPresent)
+}
+
+// printAPITimeouts prints the API calls that exceeded their endpoint's
+// timeout by user, if there were any
+func printAPITimeouts(results []*models.StressTestResult, cfg *config.Config) {
+	timedOut := false
+	for _, result := range results {
+		if len(result.APITimeouts) > 0 {
+			timedOut = true
+		}
+	}
+	if !timedOut {
+		return
+	}
+
+	utils.Console("\n--- API Timeouts ---\n")
+	for _, result := range results {
+		for _, endpoint := range config.Endpoints {
+			if count := result.APITimeouts[endpoint]; count > 0 {
+				utils.Console("%s: %d %s calls exceeded %s\n", result.Username, count, endpoint, cfg.EndpointTimeout(endpoint))
+			}
+		}
+	}
+}
+
+// printReconciliation prints the sessions the run didn't account for
+func printReconciliation(reconciliation models.Reconciliation) {
+	utils.Console("\n--- Session Reconciliation ---\n")
+	utils.Console("Sessions on the deployment before the run: %d\n", len(reconciliation.PreExisting))
+	utils.Console("Sessions that vanished before they were destroyed: %d\n", len(reconciliation.Vanished))
+	for _, kasmID := range reconciliation.Vanished {
+		utils.Console("  - %s\n", kasmID)
+	}
+	utils.Console("Sessions still present after they were destroyed: %d\n", len(reconciliation.Remaining))
+	for _, kasm := range reconciliation.Remaining {
+		utils.Console("  - %s (%s)\n", kasm.KasmID, kasm.OperationalStatus)
+	}
+	for _, err := range reconciliation.Errors {
+		utils.Console("Could not list sessions %s\n", err)
+	}
+}
+
+// exitAborted is the exit code, OR'ed with any threshold exit codes, of a run
+// that was aborted by the breaker
+const exitAborted = 64
+
+// checkGroups checks that there are users to run and that every group has
+// sessions to start
+func checkGroups(cfg *config.Config) error {
+	groups := cfg.RunGroups()
+	if len(groups) == 0 {
+		return fmt.Errorf("at least one username is required, give it with -u or set users or groups in the config")
+	}
+	for _, group := range groups {
+		if group.Sessions > 0 {
+			continue
+		}
+		if group.Name == "" {
+			return fmt.Errorf("the number of sessions is required, give it with -n or set sessions in the config")
+		}
+		return fmt.Errorf("the number of sessions of group %s is required, set it in the group or give it with -n", group.Name)
+	}
+	return nil
+}
+
+// groupSettings records the named groups of the run
+func groupSettings(groups []config.Group) []models.GroupSettings {
+	var settings []models.GroupSettings
+	for _, group := range groups {
+		if group.Name == "" {
+			continue
+		}
+		settings = append(settings, models.GroupSettings{
+			Name:       group.Name,
+			Users:      group.Users,
+			Sessions:   group.Sessions,
+			ImageID:    group.ImageID,
+			Command:    group.Command,
+			StartDelay: group.StartDelay(),
+		})
+	}
+	return settings
+}
+
+// targetSessions returns the number of sessions the groups' users start in
+// total
+func targetSessions(groups []config.Group) int {
+	total := 0
+	for _, group := range groups {
+		total += group.Sessions * len(group.Users)
+	}
+	return total
+}
+
+// printGroups prints the results of each group of users
+func printGroups(run *models.RunResult) {
+	groups := report.Groups(run)
+	if len(groups) == 0 {
+		return
+	}
+	utils.Console("\n--- Groups ---\n")
+	writeGroups(os.Stdout, groups)
+}
+
+// writeGroups prints the outcome of each group of users as a table
+func writeGroups(w io.Writer, groups []report.GroupSummary) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Group\tUsers\tSessions\tSuccessful\tFailed\tSuccess rate\tMean start\tp95 start")
+	for _, group := range groups {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.1f%%\t%.1fs\t%.1fs\n", group.Name, group.Users, group.Sessions,
+			group.Successful, group.Failed, group.SuccessRate(), group.MeanTimeToRunning.Seconds(), group.P95TimeToRunning.Seconds())
+	}
+	tw.Flush()
+}
+
+// warnInsecure warns that TLS certificate verification is disabled, pausing
+// so the warning is seen before the screen is taken over by the run
+func warnInsecure() {
+	fmt.Fprintln(os.Stderr, "WARNING: TLS certificate verification is disabled (tls_insecure_skip_verify).")
+	fmt.Fprintln(os.Stderr, "WARNING: API credentials can be intercepted. Only use this against lab deployments.")
+	utils.Info("WARNING: TLS certificate verification is disabled")
+	time.Sleep(3 * time.Second)
+}
+
+// writeSoakSamples prints a user's soak time series as a table
+func writeSoakSamples(w io.Writer, samples []models.SoakSample) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  Time\tLive\tStarted\tFailed\tMean start\tp95 start\tDestroyed\tWorkload failures")
+	for _, sample := range samples {
+		fmt.Fprintf(tw, "  %s\t%d\t%d\t%d\t%.1fs\t%.1fs\t%d\t%d/%d\n",
+			sample.Time.Format("15:04:05"), sample.LiveSessions, sample.Started, sample.Failed,
+			sample.MeanTimeToRunning.Seconds(), sample.P95TimeToRunning.Seconds(),
+			sample.Destroyed, sample.WorkloadFailures, sample.WorkloadRuns)
+	}
+	tw.Flush()
+}
+
+// deploymentName derives a deployment name from the API host URL
+func deploymentName(apiHost string) string {
+	u, err := url.Parse(apiHost)
+	if err != nil || u.Hostname() == "" {
+		return apiHost
+	}
+	return u.Hostname()
 }
 
 func clearScreen() {
@@ -118,45 +338,130 @@ func updateDisplay() {
 	lastOutput = newOutput
 }
 
-func main() {
-	err := utils.InitLoggers()
+// runTest implements "kasm-stress-test run [flags]", which runs the stress
+// test, and returns the process exit code
+func runTest(args []string) int {
+	fs := newFlagSet("run", "run [flags]", "Starts sessions for every user, runs the command in them and destroys them when Enter is pressed.")
+	flags := newRunFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected argument %q, run 'kasm-stress-test help' for the commands\n", fs.Arg(0))
+		return 2
+	}
+
+	cfg, err := config.Load(flags.loadOptions(), flags.apply)
 	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if err := utils.InitLoggers(cfg.LogOptions()); err != nil {
 		log.Fatalf("Failed to initialize loggers: %v", err)
 	}
 	defer utils.CloseLogFile()
 
-	var usernames utils.StringSliceFlag
-	flag.Var(&usernames, "u", "Username to use (can be specified multiple times)")
-	flag.Var(&usernames, "username", "Username to use (can be specified multiple times)")
+	if err := api.InitTransport(cfg); err != nil {
+		log.Fatalf("Failed to set up the API client: %v", err)
+	}
+	if cfg.TLSInsecureSkipVerify {
+		warnInsecure()
+	}
 
-	var sessionNum utils.IntFlag
-	flag.Var(&sessionNum, "n", "Number of Kasm Sessions to start for each username specified")
-	flag.Var(&sessionNum, "number", "Number of Kasm Sessions to start for each username specified")
+	if err := checkGroups(cfg); err != nil {
+		log.Fatal(err)
+	}
+	groups := cfg.RunGroups()
+	command := cfg.Command
+
+	var reports []report.Spec
+	for _, value := range cfg.Reports {
+		spec, err := report.ParseSpec(value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		reports = append(reports, spec)
+	}
 
-	var command string
-	flag.StringVar(&command, "c", "all", "Command to run: 'cpu', 'network', or 'all' (default)")
-	flag.StringVar(&command, "command", "all", "Command to run: 'cpu', 'network', or 'all' (default)")
+	if cfg.MetricsListen != "" {
+		server, err := metrics.Serve(cfg.MetricsListen)
+		if err != nil {
+			log.Fatalf("Failed to start metrics endpoint: %v", err)
+		}
+		defer server.Close()
+		utils.Info("Serving Prometheus metrics on %s/metrics", cfg.MetricsListen)
+	}
+
+	var thresholds []slo.Threshold
+	for _, expr := range cfg.Thresholds {
+		threshold, err := slo.Parse(expr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		thresholds = append(thresholds, threshold)
+	}
+
+	startTime = time.Now()
+	runID := utils.NewRunID(startTime)
+	if err := utils.StartRunLog(runID); err != nil {
+		log.Fatalf("Failed to start the run's log: %v", err)
+	}
+	utils.Info("Starting run %s", runID)
+	if cfg.Profile != "" {
+		utils.Info("Using config profile %s", cfg.Profile)
+	}
 
-	flag.Parse()
+	deployment := cfg.Deployment
+	if deployment == "" {
+		deployment = deploymentName(cfg.APIHost)
+	}
 
-	if len(usernames) == 0 {
-		log.Fatal("At least one username is required")
+	if cfg.Influx != "" {
+		err := sink.Init(cfg.Influx, sink.Tags{
+			"run_id":     runID,
+			"deployment": deployment,
+			"profile":    cfg.Profile,
+			"image":      cfg.DefaultImageID,
+		}, api.SharedTransport())
+		if err != nil {
+			log.Fatalf("Failed to open line protocol sink: %v", err)
+		}
+		defer func() {
+			if err := sink.Close(); err != nil {
+				utils.Error("Failed to flush line protocol sink: %v", err)
+			}
+		}()
 	}
 
-	if len(sessionNum.String()) == 0 {
-		log.Fatal("Please provide the number of sessions to start")
+	if cfg.Trace != "" {
+		err := tracing.Init(cfg.Trace, api.SharedTransport(),
+			tracing.String("run_id", runID),
+			tracing.String("deployment", deployment),
+			tracing.String("profile", cfg.Profile))
+		if err != nil {
+			log.Fatalf("Failed to start trace exporter: %v", err)
+		}
+		defer func() {
+			if err := tracing.Shutdown(); err != nil {
+				utils.Error("Failed to export traces: %v", err)
+			}
+		}()
 	}
 
-	cfg, err := config.Load()
+	// Take stock of the sessions already on the deployment, so the results
+	// can be read in context
+	var reconciliation models.Reconciliation
+	preExisting, err := api.NewClient(cfg).GetKasms(context.Background())
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		utils.Error("Failed to list sessions before the run: %v", err)
+		reconciliation.Errors = append(reconciliation.Errors, fmt.Sprintf("before the run: %v", err))
+	} else {
+		reconciliation.PreExisting = preExisting
+		utils.Info("Found %d sessions on the deployment before the run", len(preExisting))
 	}
 
 	sessionStatuses = make(map[string][]SessionStatus)
 	updateChan = make(chan struct{}, 100)
 
-	startTime = time.Now()
-
 	// Clear the screen and hide the cursor
 	fmt.Print("\033[2J\033[?25l")
 	defer fmt.Print("\033[?25h") // Show the cursor when done
@@ -181,26 +486,61 @@ func main() {
 		}
 	}()
 
+	// An interrupt cancels ctx, which ends the run and skips the waits of
+	// teardown. Sessions are still destroyed unless interrupted again.
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	go func() {
+		<-ctx.Done()
+		stopSignals()
+	}()
+
+	// Sessions are reconciled until they are destroyed, including while
+	// waiting for Enter, or until the run is interrupted
+	reconcileStop := make(chan struct{})
+	if cfg.ReconcileIntervalSeconds > 0 {
+		go reconcileSessions(ctx, api.NewClient(cfg), time.Duration(cfg.ReconcileIntervalSeconds)*time.Second, reconcileStop)
+	}
+
+	// The breaker cancels runCtx to abort the run
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	breaker := stress.NewBreaker(cfg, cancelRun)
+
+	soak := cfg.SoakDurationSeconds > 0
+	soakOptions := stress.NewSoakOptions(cfg)
+
 	var wg sync.WaitGroup
-	for _, username := range usernames {
-		wg.Add(1)
-		go func(username string) {
-			defer wg.Done()
-			runner := stress.NewRunner(cfg, username, sessionNum, command)
-			allRunners = append(allRunners, runner)
-			for i := 0; i < sessionNum.Value; i++ {
-				updateSessionStatus(username, i, "Starting", 0)
-				updateChan <- struct{}{}
-			}
-			results := runner.Run(func(sessionNumber int, status string, duration time.Duration) {
-				updateSessionStatus(username, sessionNumber, status, duration)
-				updateChan <- struct{}{}
-				time.Sleep(100 * time.Millisecond) // Short delay after each status update
-			})
-			resultsMutex.Lock()
-			allResults = append(allResults, results)
-			resultsMutex.Unlock()
-		}(username)
+	for _, group := range groups {
+		for _, username := range group.Users {
+			wg.Add(1)
+			go func(group config.Group, username string) {
+				defer wg.Done()
+				runner := stress.NewRunner(cfg, group, username)
+				runner.Breaker = breaker
+				resultsMutex.Lock()
+				allRunners = append(allRunners, runner)
+				resultsMutex.Unlock()
+				for i := 0; i < group.Sessions; i++ {
+					updateSessionStatus(username, i, "Starting", 0)
+					updateChan <- struct{}{}
+				}
+				callback := func(sessionNumber int, status string, duration time.Duration) {
+					updateSessionStatus(username, sessionNumber, status, duration)
+					updateChan <- struct{}{}
+					time.Sleep(100 * time.Millisecond) // Short delay after each status update
+				}
+				var results *models.StressTestResult
+				if soak {
+					results = runner.Soak(runCtx, soakOptions, callback)
+				} else {
+					results = runner.Run(runCtx, callback)
+				}
+				resultsMutex.Lock()
+				allResults = append(allResults, results)
+				resultsMutex.Unlock()
+			}(group, username)
+		}
 	}
 
 	wg.Wait()
@@ -211,11 +551,30 @@ func main() {
 
 	// Process and print all results
 	utils.Console("\n--- Stress Test Results ---\n")
+	utils.Console("Run ID: %s\n", runID)
+	if cfg.TLSInsecureSkipVerify {
+		utils.Console("WARNING: TLS certificate verification was disabled for this run\n")
+	}
+	if cfg.Profile != "" {
+		utils.Console("Profile: %s\n", cfg.Profile)
+	}
+	if aborted, reason := breaker.Tripped(); aborted {
+		utils.Console("Run aborted: %s\n", reason)
+	}
 	for _, result := range allResults {
-		utils.Console("\nResults for user: %s\n", result.Username)
+		if result.Group != "" {
+			utils.Console("\nResults for user: %s (group %s)\n", result.Username, result.Group)
+		} else {
+			utils.Console("\nResults for user: %s\n", result.Username)
+		}
 		utils.Console("Total Kasms created: %d\n", result.TotalKasms)
 		utils.Console("Successful Kasms: %d\n", result.SuccessfulKasms)
 		utils.Console("Failed Kasms: %d\n", result.FailedKasms)
+		if result.Aborted && soak {
+			utils.Console("Soak aborted after %s\n", formatDuration(result.TotalDuration))
+		} else if result.Aborted {
+			utils.Console("Aborted after %d of %d sessions\n", len(result.KasmResults), result.TotalKasms)
+		}
 		utils.Console("Average start time: %.2f seconds\n", result.AverageStartTime.Seconds())
 		utils.Console("Total duration: %.2f seconds\n", result.TotalDuration.Seconds())
 
@@ -226,10 +585,15 @@ func main() {
 			}
 		}
 
+		if soak {
+			utils.Console("\nSoak time series:\n")
+			writeSoakSamples(os.Stdout, result.SoakSamples)
+		}
+
 		utils.Console("\nDetailed Kasm Results:\n")
 		for _, kasmResult := range result.KasmResults {
 			utils.Console("  Kasm #%d:\n", kasmResult.KasmNumber)
-			utils.Console("    Start time: %.2f seconds\n", kasmResult.StartTime.Seconds())
+			utils.Console("    Start time: %.2f seconds (±%.2f seconds)\n", kasmResult.StartTime.Seconds(), kasmResult.StartTimeResolution.Seconds())
 			if kasmResult.ExecutionError != "" {
 				utils.Console("    Error: %s\n", kasmResult.ExecutionError)
 			} else {
@@ -240,23 +604,112 @@ func main() {
 	}
 	utils.Info("Stress test completed")
 
-	// Prompt user to press Enter before destroying sessions
-	utils.Console("\nPress Enter to destroy sessions and complete the test\n")
-	bufio.NewReader(os.Stdin).ReadBytes('\n')
+	aborted, abortReason := breaker.Tripped()
+	if aborted {
+		// Clean up straight away, there is nothing worth inspecting
+		utils.Console("\nThe run was aborted, cleaning up without waiting\n")
+	} else if ctx.Err() != nil {
+		utils.Console("\nThe run was interrupted, cleaning up without waiting\n")
+	} else if soak {
+		// Soak runs are left unattended, don't leave the sessions running
+		utils.Console("\nSoak test complete, cleaning up\n")
+	} else {
+		// Prompt user to press Enter before destroying sessions
+		utils.Console("\nPress Enter to destroy sessions and complete the test\n")
+		entered := make(chan struct{})
+		go func() {
+			bufio.NewReader(os.Stdin).ReadBytes('\n')
+			close(entered)
+		}()
+		select {
+		case <-entered:
+		case <-ctx.Done():
+		}
+	}
+	close(reconcileStop)
 	utils.Console("Destroying Sessions...\n")
 
 	// Destroy all Sessions
-	var destroyErrors []error
-	for _, runner := range allRunners {
-		if err := runner.DestroyAllSessions(); err != nil {
-			utils.Error("Error destroying Kasms: %v", err)
-			destroyErrors = append(destroyErrors, err)
-		}
+	teardownOptions := stress.NewTeardownOptions(cfg)
+	teardownOptions.Progress = func(done, failed, total int) {
+		utils.Progress(done == total, "Destroyed %d of %d sessions (%d failed)", done, total, failed)
+	}
+	teardown, err := stress.Teardown(ctx, allRunners, teardownOptions)
+	if err != nil {
+		utils.Error("Error destroying Kasms: %v", err)
 	}
+	utils.Console("Teardown took %s with %d workers in %s order, %s profile\n",
+		formatDuration(teardown.FinishedAt.Sub(teardown.StartedAt)), teardown.Workers, teardown.Order, teardown.Profile)
 
-	if len(destroyErrors) == 0 {
+	if err == nil {
 		fmt.Println("\nAll Kasm sessions have been successfully destroyed. Test complete.")
 	} else {
 		utils.Error("\nTest complete, but some Kasm sessions could not be destroyed.")
 	}
+
+	if cfg.VerifyDestroy {
+		printTimeToDestroyed(allResults)
+	}
+	printAPITimeouts(allResults, cfg)
+
+	remaining, err := api.NewClient(cfg).GetKasms(context.Background())
+	if err != nil {
+		utils.Error("Failed to list sessions after the run: %v", err)
+		reconciliation.Errors = append(reconciliation.Errors, fmt.Sprintf("after the run: %v", err))
+	} else {
+		reconciliation.Remaining = stress.Remaining(remaining, allResults)
+	}
+	reconciliation.Vanished = stress.Vanished(allResults)
+	printReconciliation(reconciliation)
+
+	run := &models.RunResult{
+		RunID:      runID,
+		Deployment: deployment,
+		Profile:    cfg.Profile,
+		StartedAt:  startTime,
+		FinishedAt: time.Now(),
+		Command:    command,
+		Groups:     groupSettings(groups),
+		Results:    allResults,
+
+		AbortReason:    abortReason,
+		Teardown:       teardown,
+		Reconciliation: reconciliation,
+	}
+	if soak {
+		run.Soak = &models.SoakSettings{
+			Duration:         soakOptions.Duration,
+			TargetSessions:   targetSessions(groups),
+			ChurnPerHour:     soakOptions.ChurnPerHour,
+			WorkloadInterval: soakOptions.WorkloadInterval,
+			SampleInterval:   soakOptions.SampleInterval,
+		}
+	}
+
+	printGroups(run)
+
+	exitCode := 0
+	if aborted {
+		exitCode = exitAborted
+	}
+	if len(thresholds) > 0 {
+		var thresholdCode int
+		run.Thresholds, thresholdCode = slo.Evaluate(thresholds, run)
+		utils.Console("\n--- Thresholds ---\n")
+		slo.Write(os.Stdout, run.Thresholds)
+		if thresholdCode != 0 {
+			utils.Console("\nThresholds failed, exiting with code %d\n", exitCode|thresholdCode)
+		}
+		exitCode |= thresholdCode
+	}
+
+	for _, spec := range reports {
+		if err := report.Write(spec, run); err != nil {
+			utils.Error("Failed to write report: %v", err)
+			continue
+		}
+		utils.Console("Wrote %s report to %s\n", spec.Format, spec.Path)
+	}
+
+	return exitCode
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"kasm-stress-test/internal/api"
+	"kasm-stress-test/internal/config"
+	"kasm-stress-test/internal/report"
+	"kasm-stress-test/internal/slo"
+	"kasm-stress-test/internal/utils"
+)
+
+// runPreflight implements "kasm-stress-test preflight [flags]", which checks
+// that a run with the same flags could start: the config is valid, the log
+// can be written, the API can be reached with the credentials, every user
+// exists and every image the users run is on the deployment. It returns the
+// process exit code: 0 when every check passed, 1 when one failed and 2 on
+// errors.
+func runPreflight(args []string) int {
+	fs := newFlagSet("preflight", "preflight [flags]", "Checks that a run with the same flags could start, without starting any sessions.")
+	flags := newRunFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	cfg, err := config.Resolve(flags.loadOptions(), flags.apply)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "RESULT\tCHECK\tDETAIL")
+	failed := false
+	result := func(check string, err error, detail string, args ...any) {
+		if err != nil {
+			fmt.Fprintf(w, "FAIL\t%s\t%s\n", check, utils.Redact(err.Error()))
+			failed = true
+			return
+		}
+		fmt.Fprintf(w, "ok\t%s\t%s\n", check, fmt.Sprintf(detail, args...))
+	}
+
+	if err := checkRunConfig(cfg); err != nil {
+		// The API can't be checked with settings that may be missing
+		fmt.Fprintf(w, "FAIL\tconfig\tinvalid, see below\n")
+		w.Flush()
+		fmt.Printf("\n%v\n", err)
+		return 1
+	}
+	source := "defaults and environment"
+	if cfg.Path != "" {
+		source = cfg.Path
+	}
+	if cfg.Profile != "" {
+		source += ", profile " + cfg.Profile
+	}
+	result("config", nil, "valid (%s)", source)
+
+	if err := utils.InitLoggers(cfg.LogOptions()); err != nil {
+		result("log", err, "")
+	} else if cfg.LogPerRun {
+		defer utils.CloseLogFile()
+		dir, err := utils.LogDir()
+		result("log", err, "runs in their own files in %s", dir)
+	} else {
+		defer utils.CloseLogFile()
+		destination := "standard error"
+		if path := utils.LogPath(); path != "" {
+			destination = path
+		}
+		result("log", nil, "%s", destination)
+	}
+
+	if err := api.InitTransport(cfg); err != nil {
+		result("transport", err, "")
+		return 1
+	}
+	if cfg.TLSInsecureSkipVerify {
+		result("transport", nil, "WARNING: TLS certificate verification is disabled")
+	}
+
+	client := api.NewClient(cfg)
+	kasms, err := client.GetKasms(context.Background())
+	result("api", err, "%s reachable, %d sessions on the deployment", cfg.APIHost, len(kasms))
+	if err != nil {
+		// Every other check would fail the same way
+		return 1
+	}
+
+	for _, username := range cfg.Usernames() {
+		user, err := lookupUser(client, username)
+		if err != nil {
+			result("user "+username, err, "")
+			continue
+		}
+		sessions := 0
+		for _, kasm := range kasms {
+			if ownedBy(kasm, user) {
+				sessions++
+			}
+		}
+		result("user "+username, nil, "user ID %s, %d sessions on the deployment", user.UserID, sessions)
+	}
+
+	images, err := client.GetUserImages(context.Background(), "")
+	if err != nil {
+		result("images", err, "")
+		return 1
+	}
+	checked := make(map[string]bool)
+	for _, group := range cfg.RunGroups() {
+		if checked[group.ImageID] {
+			continue
+		}
+		checked[group.ImageID] = true
+		err := fmt.Errorf("%s is not on the deployment, run 'kasm-stress-test images' to list them", group.ImageID)
+		for _, image := range images {
+			if image.ImageID == group.ImageID {
+				err = nil
+				result("image "+group.ImageID, nil, "%s", image.FriendlyName)
+			}
+		}
+		if err != nil {
+			result("image "+group.ImageID, err, "")
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// checkRunConfig checks the config like a run does before it starts
+func checkRunConfig(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	// The config only checks the form of reports and thresholds, parsing
+	// them checks their formats and metrics
+	for _, value := range cfg.Reports {
+		if _, err := report.ParseSpec(value); err != nil {
+			return err
+		}
+	}
+	for _, expr := range cfg.Thresholds {
+		if _, err := slo.Parse(expr); err != nil {
+			return err
+		}
+	}
+	return checkGroups(cfg)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/report"
+	"kasm-stress-test/internal/slo"
+	"kasm-stress-test/internal/stats"
+	"kasm-stress-test/internal/utils"
+)
+
+// runReport implements "kasm-stress-test report [flags] result.json", which
+// summarises a result file written with --report json=path, writes it as
+// other reports and checks it against thresholds, so a run can be analysed
+// again after it finished. Given thresholds replace those evaluated by the
+// run. It returns the exit code the run would have ended with under the
+// thresholds, or 2 on errors.
+func runReport(args []string) int {
+	fs := newFlagSet("report", "report [flags] result.json", "Summarises a result file written with --report json=path, writes it as other reports and checks it against thresholds.")
+	var reportFlags, thresholdFlags utils.StringSliceFlag
+	fs.Var(&reportFlags, "report", "Write a report as format=path, where format is csv, junit, html or json (can be specified multiple times)")
+	fs.Var(&thresholdFlags, "threshold", "Pass/fail threshold such as 'success_rate>=99' or 'p95_time_to_running<=90s' (can be specified multiple times)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var reports []report.Spec
+	for _, value := range reportFlags {
+		spec, err := report.ParseSpec(value)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		reports = append(reports, spec)
+	}
+	var thresholds []slo.Threshold
+	for _, expr := range thresholdFlags {
+		threshold, err := slo.Parse(expr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		thresholds = append(thresholds, threshold)
+	}
+
+	run, err := report.ReadJSON(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	exitCode := 0
+	if run.AbortReason != "" {
+		exitCode = exitAborted
+	}
+	if len(thresholds) > 0 {
+		var thresholdCode int
+		run.Thresholds, thresholdCode = slo.Evaluate(thresholds, run)
+		exitCode |= thresholdCode
+	}
+
+	writeRunSummary(os.Stdout, run)
+	if len(run.Thresholds) > 0 {
+		fmt.Println("\n--- Thresholds ---")
+		slo.Write(os.Stdout, run.Thresholds)
+	}
+
+	for _, spec := range reports {
+		if err := report.Write(spec, run); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write report: %v\n", err)
+			return 2
+		}
+		fmt.Printf("Wrote %s report to %s\n", spec.Format, spec.Path)
+	}
+	return exitCode
+}
+
+// writeRunSummary prints the outcome of a run: its sessions, their time to
+// running, why they failed and the results of each group and user
+func writeRunSummary(w io.Writer, run *models.RunResult) {
+	fmt.Fprintf(w, "Run ID: %s\n", run.RunID)
+	fmt.Fprintf(w, "Deployment: %s\n", run.Deployment)
+	if run.Profile != "" {
+		fmt.Fprintf(w, "Profile: %s\n", run.Profile)
+	}
+	fmt.Fprintf(w, "Started: %s, took %s\n", run.StartedAt.Format("2006-01-02 15:04:05"), formatDuration(run.FinishedAt.Sub(run.StartedAt)))
+	fmt.Fprintf(w, "Command: %s\n", run.Command)
+	if run.AbortReason != "" {
+		fmt.Fprintf(w, "Run aborted: %s\n", run.AbortReason)
+	}
+
+	var sessions, successful int
+	var startTimes []float64
+	failures := make(map[string]int)
+	for _, result := range run.Results {
+		for _, kasmResult := range result.KasmResults {
+			sessions++
+			if kasmResult.ExecutionError == "" {
+				successful++
+				startTimes = append(startTimes, kasmResult.StartTime.Seconds())
+				continue
+			}
+			failureType := kasmResult.FailureType
+			if failureType == "" {
+				failureType = "unknown"
+			}
+			failures[failureType]++
+		}
+	}
+	fmt.Fprintf(w, "Sessions: %d (%d successful, %d failed", sessions, successful, sessions-successful)
+	if sessions > 0 {
+		fmt.Fprintf(w, ", %.1f%% success rate", float64(successful)/float64(sessions)*100)
+	}
+	fmt.Fprintf(w, ")\n")
+	if len(startTimes) > 0 {
+		fmt.Fprintf(w, "Time to running: mean %.1fs, p50 %.1fs, p95 %.1fs, max %.1fs\n",
+			stats.Mean(startTimes), stats.Percentile(startTimes, 50),
+			stats.Percentile(startTimes, 95), stats.Percentile(startTimes, 100))
+	}
+	if len(failures) > 0 {
+		failureTypes := make([]string, 0, len(failures))
+		for failureType := range failures {
+			failureTypes = append(failureTypes, failureType)
+		}
+		sort.Strings(failureTypes)
+		fmt.Fprintf(w, "Failures:")
+		for _, failureType := range failureTypes {
+			fmt.Fprintf(w, " %s %d", failureType, failures[failureType])
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	if teardown := run.Teardown; teardown != nil {
+		fmt.Fprintf(w, "Teardown: %d destroyed, %d failed in %s\n", teardown.Destroyed, teardown.Failed, formatDuration(teardown.FinishedAt.Sub(teardown.StartedAt)))
+	}
+
+	if groups := report.Groups(run); len(groups) > 0 {
+		fmt.Fprintln(w)
+		writeGroups(w, groups)
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "User\tSessions\tSuccessful\tFailed\tDestroy failures\tAverage start time")
+	for _, result := range run.Results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.1fs\n", result.Username, result.TotalKasms, result.SuccessfulKasms,
+			result.FailedKasms, result.DestroyFailures, result.AverageStartTime.Seconds())
+	}
+	tw.Flush()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"kasm-stress-test/internal/api"
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/utils"
+)
+
+// runUsers implements "kasm-stress-test users [flags]", which looks up the
+// test users given with -u or in the config and counts the sessions each has
+// on the deployment. It returns the process exit code: 0 when every user
+// exists, 1 when one doesn't and 2 on errors.
+func runUsers(args []string) int {
+	fs := newFlagSet("users", "users [flags]", "Looks up the test users and counts the sessions each has on the deployment.")
+	flags := newAPIFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	cfg, err := connect(flags, "default_image_id")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer utils.CloseLogFile()
+	if len(cfg.Usernames()) == 0 {
+		fmt.Fprintln(os.Stderr, "At least one username is required, give it with -u or set users or groups in the config")
+		return 2
+	}
+
+	client := api.NewClient(cfg)
+	kasms, err := client.GetKasms(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	exitCode := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tUSER ID\tSESSIONS")
+	for _, username := range cfg.Usernames() {
+		user, err := lookupUser(client, username)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t%s\t\n", username, err)
+			exitCode = 1
+			continue
+		}
+		sessions := 0
+		for _, kasm := range kasms {
+			if ownedBy(kasm, user) {
+				sessions++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\n", user.Username, user.UserID, sessions)
+	}
+	w.Flush()
+	return exitCode
+}
+
+// lookupUser returns a user, failing if the deployment doesn't know it
+func lookupUser(client *api.Client, username string) (*models.User, error) {
+	user, err := client.GetUserInfo(context.Background(), username)
+	if err != nil {
+		return nil, err
+	}
+	if user.UserID == "" {
+		return nil, fmt.Errorf("user %s not found", username)
+	}
+	if user.Username == "" {
+		user.Username = username
+	}
+	return user, nil
+}
+
+// ownedBy reports whether a session on the deployment belongs to user
+func ownedBy(kasm models.KasmInfo, user *models.User) bool {
+	return kasm.UserID == user.UserID || (kasm.User.Username != "" && kasm.User.Username == user.Username)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// version is set when building a release, with
+// -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// runVersion implements "kasm-stress-test version", which prints the version
+// and the commit it was built from, and returns the process exit code
+func runVersion(args []string) int {
+	fs := newFlagSet("version", "version", "Prints the version of the tool and the commit it was built from.")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	v := version
+	// Binaries installed with "go install ...@version" know their version
+	if v == "dev" && ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v = info.Main.Version
+	}
+	fmt.Printf("kasm-stress-test %s\n", v)
+	if !ok {
+		return 0
+	}
+
+	settings := make(map[string]string)
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	if revision := settings["vcs.revision"]; revision != "" {
+		if settings["vcs.modified"] == "true" {
+			revision += " (modified)"
+		}
+		fmt.Printf("Commit: %s\n", revision)
+	}
+	if built := settings["vcs.time"]; built != "" {
+		fmt.Printf("Commit time: %s\n", built)
+	}
+	fmt.Printf("Go: %s\n", info.GoVersion)
+	return 0
+}
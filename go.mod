@@ -1,3 +1,5 @@
 module kasm-stress-test
 
 go 1.23.1
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -2,34 +2,90 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"kasm-stress-test/internal/config"
+	"kasm-stress-test/internal/metrics"
+	"kasm-stress-test/internal/sink"
+	"kasm-stress-test/internal/tracing"
+	"kasm-stress-test/internal/utils"
 )
 
 // Client represents the API client for interacting with the Kasm API
 type Client struct {
 	config     *config.Config
 	httpClient *http.Client
+	// Username tags the API call events recorded by this client
+	Username string
+
+	timeoutsMutex sync.Mutex
+	timeouts      map[string]int
+}
+
+// TimeoutError is returned when an API call takes longer than the timeout of
+// its endpoint
+type TimeoutError struct {
+	Endpoint string
+	Timeout  time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Endpoint, e.Timeout)
+}
+
+// TimedOutEndpoint returns the endpoint whose timeout caused err, if any
+func TimedOutEndpoint(err error) string {
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return timeoutErr.Endpoint
+	}
+	return ""
 }
 
 // NewClient creates a new API client
 func NewClient(cfg *config.Config) *Client {
 	return &Client{
 		config: cfg,
+		// Calls are bounded by the timeout of their endpoint instead of a
+		// client-wide timeout
 		httpClient: &http.Client{
-			Timeout: time.Duration(cfg.Timeout) * time.Second,
+			Transport: SharedTransport(),
 		},
+		timeouts: make(map[string]int),
 	}
 }
 
-// post sends a POST request to the specified endpoint
-func (c *Client) post(endpoint string, body interface{}) ([]byte, error) {
+// Timeouts returns the number of calls that timed out, by endpoint
+func (c *Client) Timeouts() map[string]int {
+	c.timeoutsMutex.Lock()
+	defer c.timeoutsMutex.Unlock()
+	timeouts := make(map[string]int, len(c.timeouts))
+	for endpoint, count := range c.timeouts {
+		timeouts[endpoint] = count
+	}
+	return timeouts
+}
+
+// timeoutError records that a call to endpoint timed out
+func (c *Client) timeoutError(endpoint string, timeout time.Duration) error {
+	c.timeoutsMutex.Lock()
+	c.timeouts[endpoint]++
+	c.timeoutsMutex.Unlock()
+	metrics.APITimeouts.Inc(endpoint)
+	return &TimeoutError{Endpoint: endpoint, Timeout: timeout}
+}
+
+// post sends a POST request to the specified endpoint, recorded as a child
+// span of any span carried by ctx
+func (c *Client) post(ctx context.Context, endpoint string, body interface{}) (respBody []byte, err error) {
 	// Ensure the APIHost ends with a slash if it doesn't already
 	apiBase := strings.TrimSuffix(c.config.APIHost, "/") + "/"
 	// Ensure the endpoint doesn't start with a slash
@@ -37,12 +93,39 @@ func (c *Client) post(endpoint string, body interface{}) ([]byte, error) {
 
 	url := apiBase + endpoint
 
+	ctx, span := tracing.Start(ctx, "POST "+endpoint, tracing.KindClient,
+		tracing.String("http.request.method", "POST"),
+		tracing.String("url.path", endpoint))
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start)
+		metrics.ObserveAPICall(endpoint, duration, err)
+		sink.APICall(c.Username, endpoint, start, duration, err)
+		log := utils.LoggerFromContext(ctx).With("endpoint", endpoint)
+		if err != nil {
+			log.Debug("POST %s failed after %s: %v", endpoint, duration.Round(time.Millisecond), err)
+		} else {
+			log.Debug("POST %s took %s", endpoint, duration.Round(time.Millisecond))
+		}
+		span.RecordError(err)
+		span.End()
+	}()
+
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling request body: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	timeout := c.config.EndpointTimeout(endpoint)
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// The call timed out if its own deadline passed, rather than the run
+	// being cancelled
+	timedOut := func() bool {
+		return errors.Is(callCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+	}
+
+	req, err := http.NewRequestWithContext(callCtx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
@@ -51,24 +134,31 @@ func (c *Client) post(endpoint string, body interface{}) ([]byte, error) {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		if timedOut() {
+			return nil, c.timeoutError(endpoint, timeout)
+		}
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(tracing.Int("http.response.status_code", resp.StatusCode))
 
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err = io.ReadAll(resp.Body)
 	if err != nil {
+		if timedOut() {
+			return nil, c.timeoutError(endpoint, timeout)
+		}
 		return nil, fmt.Errorf("error reading response body: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, utils.Redact(string(respBody)))
 	}
 
 	return respBody, nil
 }
 
 // apiRequest is a helper function to handle common API request structure
-func (c *Client) apiRequest(endpoint string, additionalData map[string]interface{}) ([]byte, error) {
+func (c *Client) apiRequest(ctx context.Context, endpoint string, additionalData map[string]interface{}) ([]byte, error) {
 	requestBody := map[string]interface{}{
 		"api_key":        c.config.APIKey,
 		"api_key_secret": c.config.APISecret,
@@ -79,5 +169,5 @@ func (c *Client) apiRequest(endpoint string, additionalData map[string]interface
 		requestBody[k] = v
 	}
 
-	return c.post(endpoint, requestBody)
+	return c.post(ctx, endpoint, requestBody)
 }
@@ -1,17 +1,20 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"kasm-stress-test/internal/metrics"
 	"kasm-stress-test/internal/models"
 	"kasm-stress-test/internal/utils"
 )
 
 // RequestKasm creates a new Kasm session
-func (c *Client) RequestKasm(userID, imageID string) (*models.Kasm, error) {
-	respBody, err := c.apiRequest("request_kasm", map[string]interface{}{
+func (c *Client) RequestKasm(ctx context.Context, userID, imageID string) (*models.Kasm, error) {
+	respBody, err := c.apiRequest(ctx, "request_kasm", map[string]interface{}{
 		"user_id":        userID,
 		"image_id":       imageID,
 		"enable_sharing": false,
@@ -23,23 +26,23 @@ func (c *Client) RequestKasm(userID, imageID string) (*models.Kasm, error) {
 
 	var kasm models.Kasm
 	if err := json.Unmarshal(respBody, &kasm); err != nil {
-		utils.Error("Failed to unmarshal Kasm response: %v", err)
+		utils.LoggerFromContext(ctx).Error("Failed to unmarshal Kasm response: %v", err)
 		return nil, fmt.Errorf("failed to unmarshal Kasm response: %w", err)
 	}
 
 	if kasm.KasmID == "" {
-		utils.Error("Kasm ID is empty in the response")
+		utils.LoggerFromContext(ctx).Error("Kasm ID is empty in the response")
 		return nil, fmt.Errorf("received empty Kasm ID from API")
 	}
 
-	utils.Info("Successfully created Kasm with ID: %s", kasm.KasmID)
+	utils.LoggerFromContext(ctx).With("kasm_id", kasm.KasmID).Info("Successfully created Kasm with ID: %s", kasm.KasmID)
 
 	return &kasm, nil
 }
 
 // GetKasmStatus retrieves the status of a Kasm session
-func (c *Client) GetKasmStatus(kasmID, user_id string) (*models.KasmStatus, error) {
-	respBody, err := c.apiRequest("get_kasm_status", map[string]interface{}{
+func (c *Client) GetKasmStatus(ctx context.Context, kasmID, user_id string) (*models.KasmStatus, error) {
+	respBody, err := c.apiRequest(ctx, "get_kasm_status", map[string]interface{}{
 		"user_id": user_id,
 		"kasm_id": kasmID,
 	})
@@ -55,8 +58,23 @@ func (c *Client) GetKasmStatus(kasmID, user_id string) (*models.KasmStatus, erro
 	return &status, nil
 }
 
+// GetKasms lists every session on the deployment
+func (c *Client) GetKasms(ctx context.Context) ([]models.KasmInfo, error) {
+	respBody, err := c.apiRequest(ctx, "get_kasms", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Kasms: %w", err)
+	}
+
+	var response models.KasmsResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Kasms: %w", err)
+	}
+
+	return response.Kasms, nil
+}
+
 // ExecCommand executes a command in a Kasm session
-func (c *Client) ExecCommand(kasmID, userID, command string) error {
+func (c *Client) ExecCommand(ctx context.Context, kasmID, userID, command string) error {
 	requestBody := map[string]interface{}{
 		"kasm_id": kasmID,
 		"user_id": userID,
@@ -65,7 +83,7 @@ func (c *Client) ExecCommand(kasmID, userID, command string) error {
 		},
 	}
 
-	_, err := c.apiRequest("exec_command_kasm", requestBody)
+	_, err := c.apiRequest(ctx, "exec_command_kasm", requestBody)
 	if err != nil {
 		return fmt.Errorf("failed to execute command: %w", err)
 	}
@@ -74,10 +92,10 @@ func (c *Client) ExecCommand(kasmID, userID, command string) error {
 }
 
 // DestroyKasm destroys a Kasm session
-func (c *Client) DestroyKasm(kasmID, userID string) error {
+func (c *Client) DestroyKasm(ctx context.Context, kasmID, userID string) error {
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		respBody, err := c.apiRequest("destroy_kasm", map[string]interface{}{
+		respBody, err := c.apiRequest(ctx, "destroy_kasm", map[string]interface{}{
 			"kasm_id": kasmID,
 			"user_id": userID,
 		})
@@ -98,42 +116,133 @@ func (c *Client) DestroyKasm(kasmID, userID string) error {
 			}
 
 			// If we get here, there was a non-empty response without an error message
-			return fmt.Errorf("unexpected response when destroying Kasm: %s", string(respBody))
+			return fmt.Errorf("unexpected response when destroying Kasm: %s", utils.Redact(string(respBody)))
 		}
 
-		utils.Error("Attempt %d to destroy Kasm %s failed: %v. Retrying...", i+1, kasmID, err)
-		time.Sleep(time.Second * time.Duration(i+1))
+		utils.LoggerFromContext(ctx).Error("Attempt %d to destroy Kasm %s failed: %v. Retrying...", i+1, kasmID, err)
+		metrics.Retries.Inc("destroy_kasm")
+		if err := sleep(ctx, time.Second*time.Duration(i+1)); err != nil {
+			return err
+		}
 	}
 
 	return fmt.Errorf("failed to destroy Kasm after %d attempts", maxRetries)
 }
 
-// WaitForKasmReady waits for a Kasm session to be in the "running" state
-func (c *Client) WaitForKasmReady(kasmID, image_id string, timeout time.Duration) error {
+// WaitForKasmsGone polls the status of destroyed Kasms according to policy
+// until they are gone or policy.DestroyTimeout has passed. gone is called for
+// each Kasm as it disappears with the time of the last poll that saw it
+// present, zero if there was none, and the time of the poll that found it
+// gone. It returns the Kasms that were still present at the timeout.
+func (c *Client) WaitForKasmsGone(ctx context.Context, kasmIDs []string, userID string, policy PollPolicy, gone func(kasmID string, lastSeen, goneAt time.Time)) ([]string, error) {
+	start := time.Now()
+	interval := policy.first()
+	pending := append([]string(nil), kasmIDs...)
+	lastSeen := make(map[string]time.Time)
+
+	for {
+		var present []string
+		for _, kasmID := range pending {
+			pollTime := time.Now()
+			status, err := c.GetKasmStatus(ctx, kasmID, userID)
+			if KasmGone(status, err) {
+				gone(kasmID, lastSeen[kasmID], pollTime)
+				continue
+			}
+			if err != nil {
+				utils.LoggerFromContext(ctx).With("kasm_id", kasmID).Error("Failed to get status of destroyed Kasm %s: %v", kasmID, err)
+			}
+			lastSeen[kasmID] = pollTime
+			present = append(present, kasmID)
+		}
+		pending = present
+
+		if len(pending) == 0 || time.Since(start) >= policy.DestroyTimeout {
+			return pending, nil
+		}
+		utils.LoggerFromContext(ctx).Info("Waiting for %d destroyed Kasms to disappear (%s)", len(pending), time.Since(start).Round(time.Second))
+		if err := pollWait(ctx, interval); err != nil {
+			return pending, err
+		}
+		interval = policy.next(interval)
+	}
+}
+
+// KasmGone reports whether the status and error returned by GetKasmStatus
+// show the Kasm no longer exists
+func KasmGone(status *models.KasmStatus, err error) bool {
+	if err != nil {
+		return strings.Contains(strings.ToLower(err.Error()), "not found")
+	}
+	return status.Kasm.KasmID == ""
+}
+
+// Keepalive resets the idle timer of a Kasm session, keeping it from expiring
+func (c *Client) Keepalive(ctx context.Context, kasmID string) error {
+	respBody, err := c.apiRequest(ctx, "keepalive", map[string]interface{}{
+		"kasm_id": kasmID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to keep Kasm alive: %w", err)
+	}
+
+	var result map[string]interface{}
+	if len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return fmt.Errorf("failed to parse keepalive response: %w", err)
+		}
+	}
+	if errMsg, ok := result["error_message"].(string); ok && errMsg != "" {
+		return fmt.Errorf("failed to keep Kasm alive: %s", errMsg)
+	}
+
+	return nil
+}
+
+// ParseKasmTime parses a timestamp returned by the Kasm API, such as a Kasm's
+// expiration date. Kasm reports times in UTC without a zone.
+func ParseKasmTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02 15:04:05", value)
+}
+
+// WaitForKasmReady waits for a Kasm session to be in the "running" state,
+// polling according to policy. On success it returns the running status and
+// the measurement resolution: the gap between the last poll that saw the Kasm
+// not yet running and the poll that saw it running.
+func (c *Client) WaitForKasmReady(ctx context.Context, kasmID, userID string, policy PollPolicy) (*models.KasmStatus, time.Duration, error) {
 	start := time.Now()
+	lastPoll := start
+	interval := policy.first()
 	requestedTime := time.Time{}
-	maxRequestedTime := 5 * time.Minute // Maximum time to wait in "requested" state
 	lastNotificationTime := time.Time{}
 	notificationInterval := 30 * time.Second
 
-	for time.Since(start) < timeout {
-		status, err := c.GetKasmStatus(kasmID, image_id)
+	for time.Since(start) < policy.Timeout {
+		pollTime := time.Now()
+		status, err := c.GetKasmStatus(ctx, kasmID, userID)
 		if err != nil {
-			utils.Error("Failed to get Kasm status: %v", err)
-			time.Sleep(15 * time.Second)
+			utils.LoggerFromContext(ctx).Error("Failed to get Kasm status: %v", err)
+			if err := pollWait(ctx, interval); err != nil {
+				return nil, 0, err
+			}
+			interval = policy.next(interval)
 			continue
 		}
 
 		if status.Kasm.OperationalStatus == "running" {
-			return nil
+			return status, pollTime.Sub(lastPoll), nil
 		}
+		lastPoll = pollTime
 
 		if status.ErrorMessage == "This session is currently requested." {
 			if requestedTime.IsZero() {
 				requestedTime = time.Now()
 				utils.Console("Kasm %s is in requested state\n", kasmID)
-			} else if time.Since(requestedTime) > maxRequestedTime {
-				return fmt.Errorf("Kasm %s stuck in 'requested' state for too long", kasmID)
+			} else if time.Since(requestedTime) > policy.RequestedLimit {
+				return nil, 0, fmt.Errorf("Kasm %s stuck in 'requested' state for too long", kasmID)
 			}
 		} else {
 			requestedTime = time.Time{} // Reset if not in "requested" state
@@ -145,17 +254,14 @@ func (c *Client) WaitForKasmReady(kasmID, image_id string, timeout time.Duration
 			lastNotificationTime = time.Now()
 		}
 
-		utils.Info("Kasm %s status: Requested. Message: %s. Progress: %d%%. Waiting... (%s)",
+		utils.LoggerFromContext(ctx).Info("Kasm %s status: Requested. Message: %s. Progress: %d%%. Waiting %s... (%s)",
 			kasmID, status.OperationalMessage,
-			status.OperationalProgress, time.Since(start))
+			status.OperationalProgress, interval, time.Since(start))
 
-		time.Sleep(30 * time.Second)
+		if err := pollWait(ctx, interval); err != nil {
+			return nil, 0, err
+		}
+		interval = policy.next(interval)
 	}
-	return fmt.Errorf("timeout waiting for Kasm %s to be ready", kasmID)
-}
-
-// GetAutoscalingStatus retrieves the current autoscaling status
-func (c *Client) GetAutoscalingStatus() (*models.AutoscalingStatus, error) {
-	// Placeholder for future implementation
-	return nil, nil
+	return nil, 0, fmt.Errorf("timeout waiting for Kasm %s to be ready", kasmID)
 }
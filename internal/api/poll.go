@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"kasm-stress-test/internal/config"
+	"kasm-stress-test/internal/tracing"
+)
+
+// PollPolicy controls how often WaitForKasmReady and WaitForKasmsGone poll
+// the Kasm status and how long they are willing to wait
+type PollPolicy struct {
+	Adaptive        bool
+	Interval        time.Duration
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Backoff         float64
+	Timeout         time.Duration
+	RequestedLimit  time.Duration
+	DestroyTimeout  time.Duration
+}
+
+// NewPollPolicy builds a PollPolicy from the config
+func NewPollPolicy(cfg *config.Config) PollPolicy {
+	return PollPolicy{
+		Adaptive:        cfg.PollMode == config.PollModeAdaptive,
+		Interval:        secondsToDuration(cfg.PollIntervalSeconds),
+		InitialInterval: secondsToDuration(cfg.PollInitialIntervalSeconds),
+		MaxInterval:     secondsToDuration(cfg.PollMaxIntervalSeconds),
+		Backoff:         cfg.PollBackoff,
+		Timeout:         time.Duration(cfg.ReadyTimeoutSeconds) * time.Second,
+		RequestedLimit:  time.Duration(cfg.RequestedLimitSeconds) * time.Second,
+		DestroyTimeout:  time.Duration(cfg.DestroyTimeoutSeconds) * time.Second,
+	}
+}
+
+// first returns the delay before the second poll
+func (p PollPolicy) first() time.Duration {
+	if p.Adaptive {
+		return p.InitialInterval
+	}
+	return p.Interval
+}
+
+// next returns the delay to use after a poll that waited for current
+func (p PollPolicy) next(current time.Duration) time.Duration {
+	if !p.Adaptive {
+		return p.Interval
+	}
+	next := time.Duration(float64(current) * p.Backoff)
+	if next > p.MaxInterval {
+		next = p.MaxInterval
+	}
+	return next
+}
+
+// sleep waits for d, returning early with the context's error if ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pollWait sleeps between two status polls inside its own span
+func pollWait(ctx context.Context, interval time.Duration) error {
+	ctx, span := tracing.Start(ctx, "poll_wait", tracing.KindInternal,
+		tracing.Int("interval_ms", int(interval.Milliseconds())))
+	defer span.End()
+	err := sleep(ctx, interval)
+	span.RecordError(err)
+	return err
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
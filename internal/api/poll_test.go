@@ -0,0 +1,72 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"kasm-stress-test/internal/config"
+)
+
+func TestPollPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy PollPolicy
+		// want are the delays after the first poll and each following one
+		want []time.Duration
+	}{
+		{
+			name:   "fixed",
+			policy: PollPolicy{Interval: 2 * time.Second, InitialInterval: time.Second, MaxInterval: 10 * time.Second, Backoff: 2},
+			want:   []time.Duration{2 * time.Second, 2 * time.Second, 2 * time.Second},
+		},
+		{
+			name:   "adaptive",
+			policy: PollPolicy{Adaptive: true, InitialInterval: 500 * time.Millisecond, MaxInterval: 10 * time.Second, Backoff: 2},
+			want:   []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name:   "adaptive capped",
+			policy: PollPolicy{Adaptive: true, InitialInterval: time.Second, MaxInterval: 5 * time.Second, Backoff: 3},
+			want:   []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			name:   "adaptive fractional backoff",
+			policy: PollPolicy{Adaptive: true, InitialInterval: time.Second, MaxInterval: 2 * time.Second, Backoff: 1.5},
+			want:   []time.Duration{time.Second, 1500 * time.Millisecond, 2 * time.Second, 2 * time.Second},
+		},
+		{
+			name:   "adaptive without backoff",
+			policy: PollPolicy{Adaptive: true, InitialInterval: time.Second, MaxInterval: 5 * time.Second, Backoff: 1},
+			want:   []time.Duration{time.Second, time.Second, time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []time.Duration{tt.policy.first()}
+			for len(got) < len(tt.want) {
+				got = append(got, tt.policy.next(got[len(got)-1]))
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("delays = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestNewPollPolicy(t *testing.T) {
+	policy := NewPollPolicy(&config.Config{
+		PollMode:                   config.PollModeAdaptive,
+		PollIntervalSeconds:        2,
+		PollInitialIntervalSeconds: 0.25,
+		PollMaxIntervalSeconds:     7.5,
+		PollBackoff:                1.5,
+		ReadyTimeoutSeconds:        90,
+	})
+	if !policy.Adaptive || policy.Interval != 2*time.Second || policy.InitialInterval != 250*time.Millisecond ||
+		policy.MaxInterval != 7500*time.Millisecond || policy.Backoff != 1.5 || policy.Timeout != 90*time.Second {
+		t.Errorf("NewPollPolicy() = %+v", policy)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"kasm-stress-test/internal/config"
+)
+
+var (
+	// transport is shared by every Client, so they share a connection pool
+	transport      http.RoundTripper = http.DefaultTransport
+	transportMutex sync.RWMutex
+)
+
+// InitTransport sets up the HTTP transport used by every Client from the
+// TLS, proxy and connection pool settings in cfg. Until InitTransport is
+// called, clients use http.DefaultTransport.
+func InitTransport(cfg *config.Config) error {
+	t, err := NewTransport(cfg)
+	if err != nil {
+		return err
+	}
+	transportMutex.Lock()
+	transport = t
+	transportMutex.Unlock()
+	return nil
+}
+
+// NewTransport creates an HTTP transport from the TLS, proxy and connection
+// pool settings in cfg
+func NewTransport(cfg *config.Config) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	t.MaxIdleConnsPerHost = cfg.HTTPMaxIdleConnsPerHost
+	t.MaxIdleConns = max(t.MaxIdleConns, cfg.HTTPMaxIdleConnsPerHost)
+	t.IdleConnTimeout = time.Duration(cfg.HTTPIdleConnTimeoutSeconds) * time.Second
+	t.DisableKeepAlives = !cfg.HTTPKeepAlive
+
+	switch cfg.HTTPProxy {
+	case "":
+		// Keep the default of using HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	case config.HTTPProxyDirect:
+		t.Proxy = nil
+	default:
+		proxyURL, err := url.Parse(cfg.HTTPProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %w", err)
+		}
+		// The bundle is added to the system roots, so public and internal
+		// certificates are both trusted
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA bundle %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	t.TLSClientConfig = tlsConfig
+
+	return t, nil
+}
+
+// SharedTransport returns the transport set up by InitTransport, so other
+// HTTP clients of the run, such as exporters, honour the same TLS and proxy
+// settings
+func SharedTransport() http.RoundTripper {
+	transportMutex.RLock()
+	defer transportMutex.RUnlock()
+	return transport
+}
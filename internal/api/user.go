@@ -1,13 +1,15 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+
 	"kasm-stress-test/internal/models"
 )
 
 // GetUserInfo retrieves user information about a specific user
-func (c *Client) GetUserInfo(username string) (*models.User, error) {
+func (c *Client) GetUserInfo(ctx context.Context, username string) (*models.User, error) {
 	postBody := map[string]interface{}{
 		"api_key":        c.config.APIKey,
 		"api_key_secret": c.config.APISecret,
@@ -16,7 +18,7 @@ func (c *Client) GetUserInfo(username string) (*models.User, error) {
 		},
 	}
 
-	body, err := c.apiRequest("/get_user", postBody)
+	body, err := c.apiRequest(ctx, "/get_user", postBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
@@ -30,13 +32,13 @@ func (c *Client) GetUserInfo(username string) (*models.User, error) {
 }
 
 // GetUserImages retrieves the images available to a specific user
-func (c *Client) GetUserImages(userID string) ([]models.Image, error) {
+func (c *Client) GetUserImages(ctx context.Context, userID string) ([]models.Image, error) {
 	postBody := map[string]interface{}{
 		"api_key":        c.config.APIKey,
 		"api_key_secret": c.config.APISecret,
 	}
 
-	body, err := c.apiRequest("get_images", postBody)
+	body, err := c.apiRequest(ctx, "get_images", postBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user images: %w", err)
 	}
@@ -0,0 +1,309 @@
+package compare
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/stats"
+)
+
+// Options controls when a difference between two runs counts as a regression
+type Options struct {
+	// Alpha is the significance level a difference must reach. The sections
+	// of each image share it, each being tested at Alpha divided by the
+	// number of images (Bonferroni correction).
+	Alpha float64
+	// MinChange is the smallest relative increase of the median time to
+	// running, e.g. 0.1 for 10%, that is reported as a regression even when
+	// significant
+	MinChange float64
+}
+
+// DefaultOptions are used when no options are given on the command line
+var DefaultOptions = Options{
+	Alpha:     0.05,
+	MinChange: 0.1,
+}
+
+// sample holds the sessions of one run, or of one image within a run
+type sample struct {
+	sessions   int
+	successful int
+	startTimes []float64
+	failures   map[string]int
+}
+
+func newSample() *sample {
+	return &sample{failures: make(map[string]int)}
+}
+
+func (s *sample) add(kasmResult models.KasmResult) {
+	s.sessions++
+	if kasmResult.ExecutionError == "" {
+		s.successful++
+		s.startTimes = append(s.startTimes, kasmResult.StartTime.Seconds())
+		return
+	}
+	failureType := kasmResult.FailureType
+	if failureType == "" {
+		failureType = "unknown"
+	}
+	s.failures[failureType]++
+}
+
+func (s *sample) successRate() float64 {
+	if s.sessions == 0 {
+		return 0
+	}
+	return float64(s.successful) / float64(s.sessions)
+}
+
+// Row is a single compared statistic. Rows without a p-value are shown for
+// reference and are never flagged.
+type Row struct {
+	Name       string
+	Old        string
+	New        string
+	Change     string
+	PValue     string
+	Regression bool
+}
+
+// Section is a titled table of compared statistics
+type Section struct {
+	Title string
+	Rows  []Row
+}
+
+// Comparison is the result of comparing two runs
+type Comparison struct {
+	Old         *models.RunResult
+	New         *models.RunResult
+	Sections    []Section
+	Regressions []string
+}
+
+// Runs compares a baseline run against a new run
+func Runs(oldRun, newRun *models.RunResult, opts Options) *Comparison {
+	c := &Comparison{Old: oldRun, New: newRun}
+
+	oldAll, oldImages := collect(oldRun)
+	newAll, newImages := collect(newRun)
+
+	c.Sections = append(c.Sections, Section{Title: "Overall", Rows: c.compareSamples("", oldAll, newAll, opts)})
+	c.Sections = append(c.Sections, Section{Title: "Failure categories", Rows: c.compareFailures(oldAll, newAll, opts)})
+
+	images := make(map[string]bool)
+	for image := range oldImages {
+		images[image] = true
+	}
+	for image := range newImages {
+		images[image] = true
+	}
+	var imageIDs []string
+	for image := range images {
+		imageIDs = append(imageIDs, image)
+	}
+	sort.Strings(imageIDs)
+	// Testing every image at the full level would flag some image by chance
+	// more often than Alpha
+	imageOpts := opts
+	if len(imageIDs) > 1 {
+		imageOpts.Alpha = opts.Alpha / float64(len(imageIDs))
+	}
+	for _, image := range imageIDs {
+		oldImage, newImage := oldImages[image], newImages[image]
+		if oldImage == nil {
+			oldImage = newSample()
+		}
+		if newImage == nil {
+			newImage = newSample()
+		}
+		c.Sections = append(c.Sections, Section{
+			Title: "Image " + image,
+			Rows:  c.compareSamples("image "+image+" ", oldImage, newImage, imageOpts),
+		})
+	}
+
+	return c
+}
+
+func collect(run *models.RunResult) (*sample, map[string]*sample) {
+	all := newSample()
+	images := make(map[string]*sample)
+	for _, result := range run.Results {
+		for _, kasmResult := range result.KasmResults {
+			all.add(kasmResult)
+			image := kasmResult.ImageID
+			if image == "" {
+				image = "unknown"
+			}
+			if images[image] == nil {
+				images[image] = newSample()
+			}
+			images[image].add(kasmResult)
+		}
+	}
+	return all, images
+}
+
+// compareSamples compares success rate and time-to-running percentiles.
+// The percentiles are for reference: a single Mann-Whitney U test compares
+// the whole time-to-running distributions and is reported, and flagged, on
+// its own row. prefix qualifies the regression messages, e.g. with the
+// image.
+func (c *Comparison) compareSamples(prefix string, oldSample, newSample *sample, opts Options) []Row {
+	rows := []Row{{
+		Name: "Sessions",
+		Old:  fmt.Sprint(oldSample.sessions),
+		New:  fmt.Sprint(newSample.sessions),
+	}}
+
+	p := stats.ProportionDecrease(oldSample.successful, oldSample.sessions, newSample.successful, newSample.sessions)
+	row := Row{
+		Name:       "Success rate",
+		Old:        fmt.Sprintf("%.1f%%", oldSample.successRate()*100),
+		New:        fmt.Sprintf("%.1f%%", newSample.successRate()*100),
+		Change:     fmt.Sprintf("%+.1fpp", (newSample.successRate()-oldSample.successRate())*100),
+		PValue:     fmt.Sprintf("%.4f", p),
+		Regression: p < opts.Alpha,
+	}
+	if row.Regression {
+		c.Regressions = append(c.Regressions, fmt.Sprintf("%ssuccess rate dropped from %s to %s (p=%.4f)", prefix, row.Old, row.New, p))
+	}
+	rows = append(rows, row)
+
+	if len(oldSample.startTimes) == 0 || len(newSample.startTimes) == 0 {
+		return rows
+	}
+
+	for _, percentile := range []struct {
+		name  string
+		value float64
+	}{
+		{"Time to running p50", 50},
+		{"Time to running p90", 90},
+		{"Time to running p95", 95},
+		{"Time to running p99", 99},
+	} {
+		oldValue := stats.Percentile(oldSample.startTimes, percentile.value)
+		newValue := stats.Percentile(newSample.startTimes, percentile.value)
+		rows = append(rows, Row{
+			Name:   percentile.name,
+			Old:    fmt.Sprintf("%.1fs", oldValue),
+			New:    fmt.Sprintf("%.1fs", newValue),
+			Change: fmt.Sprintf("%+.1f%%", relativeChange(oldValue, newValue)*100),
+		})
+	}
+
+	// The test is one-sided, towards longer times in the new run, and only
+	// counts when the median grew by more than MinChange
+	p = stats.ShiftIncrease(oldSample.startTimes, newSample.startTimes)
+	oldMedian := stats.Percentile(oldSample.startTimes, 50)
+	newMedian := stats.Percentile(newSample.startTimes, 50)
+	change := relativeChange(oldMedian, newMedian)
+	row = Row{
+		Name:       "Time to running shift",
+		Old:        fmt.Sprintf("%.1fs", oldMedian),
+		New:        fmt.Sprintf("%.1fs", newMedian),
+		Change:     fmt.Sprintf("%+.1f%%", change*100),
+		PValue:     fmt.Sprintf("%.4f", p),
+		Regression: p < opts.Alpha && change > opts.MinChange,
+	}
+	if row.Regression {
+		c.Regressions = append(c.Regressions, fmt.Sprintf("%stime to running increased, median from %s to %s (%s, p=%.4f)",
+			prefix, row.Old, row.New, row.Change, p))
+	}
+	rows = append(rows, row)
+
+	return rows
+}
+
+// compareFailures compares the share of sessions failing with each failure type
+func (c *Comparison) compareFailures(oldSample, newSample *sample, opts Options) []Row {
+	types := make(map[string]bool)
+	for failureType := range oldSample.failures {
+		types[failureType] = true
+	}
+	for failureType := range newSample.failures {
+		types[failureType] = true
+	}
+	var failureTypes []string
+	for failureType := range types {
+		failureTypes = append(failureTypes, failureType)
+	}
+	sort.Strings(failureTypes)
+
+	var rows []Row
+	for _, failureType := range failureTypes {
+		oldCount, newCount := oldSample.failures[failureType], newSample.failures[failureType]
+		// A failure type increasing is the share of sessions without it decreasing
+		p := stats.ProportionDecrease(oldSample.sessions-oldCount, oldSample.sessions, newSample.sessions-newCount, newSample.sessions)
+		row := Row{
+			Name:       failureType,
+			Old:        fmt.Sprintf("%d (%.1f%%)", oldCount, share(oldCount, oldSample.sessions)*100),
+			New:        fmt.Sprintf("%d (%.1f%%)", newCount, share(newCount, newSample.sessions)*100),
+			Change:     fmt.Sprintf("%+.1fpp", (share(newCount, newSample.sessions)-share(oldCount, oldSample.sessions))*100),
+			PValue:     fmt.Sprintf("%.4f", p),
+			Regression: p < opts.Alpha,
+		}
+		if row.Regression {
+			c.Regressions = append(c.Regressions, fmt.Sprintf("%s failures increased from %s to %s (p=%.4f)", failureType, row.Old, row.New, p))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Write prints the comparison as aligned tables followed by any regressions
+func (c *Comparison) Write(w io.Writer) error {
+	fmt.Fprintf(w, "Baseline: %s (%s, %s)\n", c.Old.RunID, c.Old.Deployment, c.Old.StartedAt.Format("2006-01-02 15:04"))
+	fmt.Fprintf(w, "New:      %s (%s, %s)\n", c.New.RunID, c.New.Deployment, c.New.StartedAt.Format("2006-01-02 15:04"))
+
+	for _, section := range c.Sections {
+		fmt.Fprintf(w, "\n%s\n", section.Title)
+		if len(section.Rows) == 0 {
+			fmt.Fprintln(w, "  (none)")
+			continue
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  \tBaseline\tNew\tChange\tp-value\t")
+		for _, row := range section.Rows {
+			flag := ""
+			if row.Regression {
+				flag = "REGRESSION"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\n", row.Name, row.Old, row.New, row.Change, row.PValue, flag)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(c.Regressions) == 0 {
+		fmt.Fprintln(w, "\nNo significant regressions found.")
+		return nil
+	}
+	fmt.Fprintf(w, "\n%d regression(s) found:\n", len(c.Regressions))
+	for _, regression := range c.Regressions {
+		fmt.Fprintf(w, "  - %s\n", regression)
+	}
+	return nil
+}
+
+func relativeChange(oldValue, newValue float64) float64 {
+	if oldValue == 0 {
+		return 0
+	}
+	return (newValue - oldValue) / oldValue
+}
+
+func share(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) / float64(total)
+}
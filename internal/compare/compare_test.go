@@ -0,0 +1,163 @@
+package compare
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"kasm-stress-test/internal/models"
+)
+
+// run returns a run with a successful session per start time, in seconds,
+// for the image, followed by failed sessions of the failure type
+func run(image string, startTimes []float64, failureType string, failed int) *models.RunResult {
+	result := &models.StressTestResult{}
+	for _, startTime := range startTimes {
+		result.KasmResults = append(result.KasmResults, models.KasmResult{
+			ImageID:   image,
+			StartTime: time.Duration(startTime * float64(time.Second)),
+		})
+	}
+	for i := 0; i < failed; i++ {
+		result.KasmResults = append(result.KasmResults, models.KasmResult{
+			ImageID:        image,
+			ExecutionError: "failed",
+			FailureType:    failureType,
+		})
+	}
+	return &models.RunResult{Results: []*models.StressTestResult{result}}
+}
+
+// merge combines the sessions of runs into one run
+func merge(runs ...*models.RunResult) *models.RunResult {
+	merged := &models.RunResult{}
+	for _, run := range runs {
+		merged.Results = append(merged.Results, run.Results...)
+	}
+	return merged
+}
+
+// shifted returns values with delta added to each
+func shifted(values []float64, delta float64) []float64 {
+	result := make([]float64, len(values))
+	for i, v := range values {
+		result[i] = v + delta
+	}
+	return result
+}
+
+// findRow returns the row named name in the section titled title
+func findRow(t *testing.T, c *Comparison, title, name string) Row {
+	t.Helper()
+	for _, section := range c.Sections {
+		if section.Title != title {
+			continue
+		}
+		for _, row := range section.Rows {
+			if row.Name == name {
+				return row
+			}
+		}
+	}
+	t.Fatalf("no row %q in section %q", name, title)
+	return Row{}
+}
+
+var startTimes = []float64{10, 11, 12, 13, 14, 15, 16, 17, 18, 19}
+
+func TestRuns(t *testing.T) {
+	tests := []struct {
+		name string
+		old  *models.RunResult
+		new  *models.RunResult
+		// flagged are the flagged rows as "section/row"
+		flagged     []string
+		regressions []string
+	}{
+		{
+			name: "unchanged",
+			old:  run("img1", startTimes, "", 0),
+			new:  run("img1", startTimes, "", 0),
+		},
+		{
+			name:        "slower",
+			old:         run("img1", startTimes, "", 0),
+			new:         run("img1", shifted(startTimes, 3), "", 0),
+			flagged:     []string{"Overall/Time to running shift", "Image img1/Time to running shift"},
+			regressions: []string{"time to running increased, median from 14.5s to 17.5s", "image img1 time to running increased"},
+		},
+		{
+			// Significant, but the median grew by less than MinChange
+			name: "slightly slower",
+			old:  run("img1", shifted(startTimes, 100), "", 0),
+			new:  run("img1", shifted(startTimes, 105), "", 0),
+		},
+		{
+			name:    "failing",
+			old:     run("img1", startTimes, "", 0),
+			new:     run("img1", startTimes[:5], models.FailureReadyTimeout, 5),
+			flagged: []string{"Overall/Success rate", "Failure categories/" + models.FailureReadyTimeout, "Image img1/Success rate"},
+			regressions: []string{
+				"success rate dropped from 100.0% to 50.0%",
+				models.FailureReadyTimeout + " failures increased from 0 (0.0%) to 5 (50.0%)",
+				"image img1 success rate dropped",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Runs(tt.old, tt.new, DefaultOptions)
+
+			var flagged []string
+			for _, section := range c.Sections {
+				for _, row := range section.Rows {
+					if row.Regression {
+						flagged = append(flagged, section.Title+"/"+row.Name)
+					}
+				}
+			}
+			if strings.Join(flagged, ", ") != strings.Join(tt.flagged, ", ") {
+				t.Errorf("flagged rows = %q, want %q", flagged, tt.flagged)
+			}
+			if tt.regressions != nil && len(c.Regressions) != len(tt.regressions) {
+				t.Fatalf("regressions = %q, want %d", c.Regressions, len(tt.regressions))
+			}
+			for i, regression := range tt.regressions {
+				if !strings.Contains(c.Regressions[i], regression) {
+					t.Errorf("regression %d = %q, want it to mention %q", i, c.Regressions[i], regression)
+				}
+			}
+		})
+	}
+}
+
+// TestRunsImageSignificance checks that images share the significance level,
+// so a shift with p=0.029 is flagged for a single image but not for one of
+// two images
+func TestRunsImageSignificance(t *testing.T) {
+	c := Runs(run("img1", startTimes, "", 0), run("img1", shifted(startTimes, 3), "", 0), DefaultOptions)
+	if row := findRow(t, c, "Image img1", "Time to running shift"); !row.Regression || row.PValue != "0.0291" {
+		t.Errorf("single image row = %+v, want a regression with p-value 0.0291", row)
+	}
+
+	c = Runs(
+		merge(run("img1", startTimes, "", 0), run("img2", startTimes, "", 0)),
+		merge(run("img1", shifted(startTimes, 3), "", 0), run("img2", startTimes, "", 0)),
+		DefaultOptions,
+	)
+	if row := findRow(t, c, "Image img1", "Time to running shift"); row.Regression || row.PValue != "0.0291" {
+		t.Errorf("row of one of two images = %+v, want no regression with p-value 0.0291", row)
+	}
+}
+
+func TestRunsPercentilesForReference(t *testing.T) {
+	c := Runs(run("img1", startTimes, "", 0), run("img1", shifted(startTimes, 10), "", 0), DefaultOptions)
+	for _, name := range []string{"Time to running p50", "Time to running p90", "Time to running p95", "Time to running p99"} {
+		if row := findRow(t, c, "Overall", name); row.Regression || row.PValue != "" {
+			t.Errorf("%s = %+v, want no p-value and no regression", name, row)
+		}
+	}
+	if row := findRow(t, c, "Overall", "Time to running p50"); row.Old != "14.5s" || row.New != "24.5s" || row.Change != "+69.0%" {
+		t.Errorf("p50 = %+v, want 14.5s to 24.5s, +69.0%%", row)
+	}
+}
@@ -1,10 +1,14 @@
 package config
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"kasm-stress-test/internal/utils"
 )
 
 // Config holds all configuration for the application
@@ -14,83 +18,318 @@ type Config struct {
 	APIHost        string `json:"api_host"`
 	DefaultImageID string `json:"default_image_id"`
 	LogLevel       string `json:"log_level"`
-	Timeout        int    `json:"timeout_seconds"`
+	// LogFormat is the format of the log file's lines, text or json
+	LogFormat string `json:"log_format"`
+	// Log destination. Lines go to LogFile in LogDir, the executable's
+	// directory when empty, or to stderr when LogFile is "stderr". With
+	// LogPerRun each run logs to its own file in LogDir. Log files are
+	// rotated at LogMaxSizeMB, keeping LogMaxFiles rotated files.
+	LogDir       string `json:"log_dir"`
+	LogFile      string `json:"log_file"`
+	LogPerRun    bool   `json:"log_per_run"`
+	LogMaxSizeMB int    `json:"log_max_size_mb"`
+	LogMaxFiles  int    `json:"log_max_files"`
+	// Timeout is the timeout of API calls to endpoints that have none in
+	// EndpointTimeoutsSeconds, which is keyed by endpoint, e.g. request_kasm
+	Timeout                 int            `json:"timeout_seconds"`
+	EndpointTimeoutsSeconds map[string]int `json:"endpoint_timeouts_seconds"`
+
+	// Transport of the API client. TLSCAFile adds a CA bundle to the system
+	// roots, TLSCertFile and TLSKeyFile set a client certificate. HTTPProxy
+	// is a proxy URL, "direct" to bypass any proxy or empty to use the
+	// standard proxy environment variables.
+	TLSCAFile                  string `json:"tls_ca_file"`
+	TLSCertFile                string `json:"tls_cert_file"`
+	TLSKeyFile                 string `json:"tls_key_file"`
+	TLSInsecureSkipVerify      bool   `json:"tls_insecure_skip_verify"`
+	HTTPProxy                  string `json:"http_proxy"`
+	HTTPMaxIdleConnsPerHost    int    `json:"http_max_idle_conns_per_host"`
+	HTTPKeepAlive              bool   `json:"http_keep_alive"`
+	HTTPIdleConnTimeoutSeconds int    `json:"http_idle_conn_timeout_seconds"`
+
+	// Status polling used while waiting for a Kasm to reach "running".
+	// In fixed mode every poll is PollIntervalSeconds apart. In adaptive mode
+	// polling starts at PollInitialIntervalSeconds and grows by PollBackoff
+	// after each poll, up to PollMaxIntervalSeconds.
+	PollMode                   string  `json:"poll_mode"`
+	PollIntervalSeconds        float64 `json:"poll_interval_seconds"`
+	PollInitialIntervalSeconds float64 `json:"poll_initial_interval_seconds"`
+	PollMaxIntervalSeconds     float64 `json:"poll_max_interval_seconds"`
+	PollBackoff                float64 `json:"poll_backoff"`
+	ReadyTimeoutSeconds        int     `json:"ready_timeout_seconds"`
+	RequestedLimitSeconds      int     `json:"requested_limit_seconds"`
+
+	// Sessions are destroyed by TeardownWorkers workers in TeardownOrder,
+	// one of the TeardownOrder* constants
+	TeardownWorkers int    `json:"teardown_workers"`
+	TeardownOrder   string `json:"teardown_order"`
+
+	// TeardownProfile, one of the TeardownProfile* constants, paces teardown
+	// to exercise scale-in
+	TeardownProfile         string  `json:"teardown_profile"`
+	TeardownDurationSeconds int     `json:"teardown_duration_seconds"`
+	TeardownSteps           int     `json:"teardown_steps"`
+	TeardownStepPercent     float64 `json:"teardown_step_percent"`
+	TeardownPauseSeconds    int     `json:"teardown_pause_seconds"`
+
+	// With VerifyDestroy set, teardown polls the status of destroyed
+	// sessions until they are gone, for at most DestroyTimeoutSeconds
+	VerifyDestroy         bool `json:"verify_destroy"`
+	DestroyTimeoutSeconds int  `json:"destroy_timeout_seconds"`
+
+	// Abort conditions evaluated while the run is in progress; zero disables
+	// a condition. AbortErrorRate is a percentage of the last
+	// AbortErrorRateWindow sessions.
+	AbortConsecutiveFailures int     `json:"abort_consecutive_failures"`
+	AbortErrorRate           float64 `json:"abort_error_rate"`
+	AbortErrorRateWindow     int     `json:"abort_error_rate_window"`
+	AbortStuckRequested      int     `json:"abort_stuck_requested"`
+
+	// Sessions that are running are kept alive until they are destroyed.
+	// Every KeepaliveIntervalSeconds, sessions expiring within
+	// KeepaliveMarginSeconds are sent a keepalive.
+	Keepalive                bool `json:"keepalive"`
+	KeepaliveIntervalSeconds int  `json:"keepalive_interval_seconds"`
+	KeepaliveMarginSeconds   int  `json:"keepalive_margin_seconds"`
+
+	// The sessions on the deployment are listed every
+	// ReconcileIntervalSeconds to find running sessions that vanished,
+	// zero disables the check. They are always listed before and after the
+	// run.
+	ReconcileIntervalSeconds int `json:"reconcile_interval_seconds"`
+
+	// Soak mode keeps the requested number of sessions per user live for
+	// SoakDurationSeconds, replacing SoakChurnPerHour sessions per user every
+	// hour and rerunning the workload every SoakWorkloadIntervalSeconds.
+	// A zero duration disables soak mode, zero churn or workload interval
+	// disables churn or repeated workloads.
+	SoakDurationSeconds         int     `json:"soak_duration_seconds"`
+	SoakChurnPerHour            float64 `json:"soak_churn_per_hour"`
+	SoakWorkloadIntervalSeconds int     `json:"soak_workload_interval_seconds"`
+	SoakSampleIntervalSeconds   int     `json:"soak_sample_interval_seconds"`
+
+	// Run options, usually given on the command line. Sessions is the
+	// number of sessions started for each of Users, Command the workload run
+	// on them. Groups replace Users when users need different sessions,
+	// images or workloads, see RunGroups.
+	Users         []string `json:"users"`
+	Groups        []Group  `json:"groups"`
+	Sessions      int      `json:"sessions"`
+	Command       string   `json:"command"`
+	Deployment    string   `json:"deployment"`
+	MetricsListen string   `json:"metrics_listen"`
+	Influx        string   `json:"influx"`
+	Trace         string   `json:"trace"`
+	Reports       []string `json:"reports"`
+
+	// Thresholds are pass/fail conditions evaluated against the results,
+	// e.g. "success_rate >= 99" or "p95_time_to_running <= 90s"
+	Thresholds []string `json:"thresholds"`
+
+	// Path is the config file the config was loaded from, if any
+	Path string `json:"-"`
+	// Profile is the name of the profile the config was loaded from, if any
+	Profile string `json:"-"`
+	// Sources records where each setting was set, by its JSON name.
+	// Settings that aren't in it have their default value.
+	Sources map[string]string `json:"-"`
+	// unknownKeys are the settings of the config file that don't exist,
+	// reported by Validate
+	unknownKeys []error
 }
 
-// Load reads the config file and environment variables to create a Config
-func Load() (*Config, error) {
-	config := &Config{
-		LogLevel: "info",
-		Timeout:  30,
-	}
+// Supported values for Command
+const (
+	CommandAll     = "all"
+	CommandCPU     = "cpu"
+	CommandNetwork = "network"
+)
 
-	// First, try to load from config file
-	if err := loadFromFile(config); err != nil {
-		fmt.Printf("Warning: Could not load config file: %v\n", err)
+// Endpoints are the Kasm API endpoints the tool calls
+var Endpoints = []string{
+	"destroy_kasm",
+	"exec_command_kasm",
+	"get_images",
+	"get_kasm_status",
+	"get_kasms",
+	"get_user",
+	"keepalive",
+	"request_kasm",
+}
+
+// EndpointTimeout returns the timeout of calls to an API endpoint
+func (c *Config) EndpointTimeout(endpoint string) time.Duration {
+	if seconds, ok := c.EndpointTimeoutsSeconds[endpoint]; ok {
+		return time.Duration(seconds) * time.Second
 	}
+	return time.Duration(c.Timeout) * time.Second
+}
 
-	// Then, override with environment variables
-	loadFromEnv(config)
+// HTTPProxyDirect bypasses any proxy set in the environment
+const HTTPProxyDirect = "direct"
 
-	// Validate the config
-	if err := config.validate(); err != nil {
-		return nil, err
+// LogStderr as LogFile writes log lines to standard error only, e.g. for
+// containers
+const LogStderr = utils.LogStderr
+
+// LogOptions returns where and how the log is written
+func (c *Config) LogOptions() utils.LogOptions {
+	return utils.LogOptions{
+		Level:     strings.ToLower(c.LogLevel),
+		Format:    c.LogFormat,
+		Dir:       c.LogDir,
+		File:      c.LogFile,
+		PerRun:    c.LogPerRun,
+		MaxSizeMB: c.LogMaxSizeMB,
+		MaxFiles:  c.LogMaxFiles,
 	}
+}
 
-	return config, nil
+// Supported values for PollMode
+const (
+	PollModeFixed    = "fixed"
+	PollModeAdaptive = "adaptive"
+)
+
+// Supported values for TeardownOrder
+const (
+	// TeardownOrderFIFO destroys the oldest sessions first
+	TeardownOrderFIFO = "fifo"
+	// TeardownOrderLIFO destroys the newest sessions first
+	TeardownOrderLIFO = "lifo"
+	// TeardownOrderRandom destroys the sessions in a random order
+	TeardownOrderRandom = "random"
+	// TeardownOrderAgent destroys the sessions agent by agent, starting
+	// with the agent running the fewest, so agents are emptied one at a time
+	TeardownOrderAgent = "agent"
+)
+
+// Supported values for TeardownProfile
+const (
+	// TeardownProfileBurst destroys every session at once
+	TeardownProfileBurst = "burst"
+	// TeardownProfileRamp destroys sessions one at a time, evenly spread
+	// over TeardownDurationSeconds
+	TeardownProfileRamp = "ramp"
+	// TeardownProfileStep destroys sessions in TeardownSteps equal steps,
+	// evenly spread over TeardownDurationSeconds
+	TeardownProfileStep = "step"
+	// TeardownProfilePercent destroys TeardownStepPercent of the sessions at
+	// a time, pausing TeardownPauseSeconds between steps
+	TeardownProfilePercent = "percent"
+)
+
+// Options selects the config file and profile to load
+type Options struct {
+	// Path is the config file to load. If empty, KASM_CONFIG or the first
+	// of the default config files in the home directory is used.
+	Path string
+	// Profile selects a named profile from the config file. If empty,
+	// KASM_PROFILE or the file's default_profile is used.
+	Profile string
 }
 
-func loadFromFile(config *Config) error {
-	home, err := os.UserHomeDir()
+// Load resolves the config like Resolve and validates it
+func Load(opts Options, overrides ...func(*Config)) (*Config, error) {
+	config, err := Resolve(opts, overrides...)
 	if err != nil {
-		return fmt.Errorf("could not get home directory: %w", err)
+		return nil, err
 	}
-
-	configPath := filepath.Join(home, ".kasm-stress-test.json")
-	file, err := os.Open(configPath)
-	if err != nil {
-		return fmt.Errorf("could not open config file: %w", err)
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
-	defer file.Close()
+	return config, nil
+}
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(config); err != nil {
-		return fmt.Errorf("could not decode config file: %w", err)
-	}
+// Resolve creates a Config by layering, from lowest to highest precedence,
+// the defaults, the config file, environment variables and any overrides
+// (typically from command-line flags). The config isn't validated.
+func Resolve(opts Options, overrides ...func(*Config)) (*Config, error) {
+	config := &Config{
+		LogLevel:     "info",
+		LogFormat:    "text",
+		LogFile:      "stress-test.log",
+		LogMaxSizeMB: 100,
+		LogMaxFiles:  3,
+		Timeout:      30,
+		// Requesting a session can legitimately take minutes while an agent
+		// is provisioned, polling its status should always be quick
+		EndpointTimeoutsSeconds: map[string]int{
+			"request_kasm":    300,
+			"get_kasm_status": 15,
+		},
 
-	return nil
-}
+		HTTPMaxIdleConnsPerHost:    100,
+		HTTPKeepAlive:              true,
+		HTTPIdleConnTimeoutSeconds: 90,
 
-func loadFromEnv(config *Config) {
-	if key := os.Getenv("KASM_KEY"); key != "" {
-		config.APIKey = key
-	}
-	if secret := os.Getenv("KASM_SECRET"); secret != "" {
-		config.APISecret = secret
+		PollMode:                   PollModeFixed,
+		PollIntervalSeconds:        30,
+		PollInitialIntervalSeconds: 1,
+		PollMaxIntervalSeconds:     30,
+		PollBackoff:                1.5,
+		ReadyTimeoutSeconds:        600,
+		RequestedLimitSeconds:      300,
+		DestroyTimeoutSeconds:      300,
+		TeardownWorkers:            10,
+		TeardownOrder:              TeardownOrderFIFO,
+		TeardownProfile:            TeardownProfileBurst,
+		TeardownSteps:              4,
+		TeardownStepPercent:        25,
+		TeardownPauseSeconds:       60,
+
+		AbortErrorRateWindow: 20,
+
+		Keepalive:                true,
+		KeepaliveIntervalSeconds: 60,
+		KeepaliveMarginSeconds:   300,
+
+		ReconcileIntervalSeconds: 60,
+
+		SoakSampleIntervalSeconds: 300,
+
+		Command: CommandAll,
+
+		Sources: make(map[string]string),
 	}
-	if host := os.Getenv("KASM_API_HOST"); host != "" {
-		config.APIHost = host
+
+	if opts.Path == "" {
+		opts.Path = os.Getenv("KASM_CONFIG")
 	}
-	if imageID := os.Getenv("KASM_DEFAULT_IMAGE_ID"); imageID != "" {
-		config.DefaultImageID = imageID
+	if opts.Profile == "" {
+		opts.Profile = os.Getenv("KASM_PROFILE")
 	}
-	if logLevel := os.Getenv("KASM_LOG_LEVEL"); logLevel != "" {
-		config.LogLevel = logLevel
+
+	// First, try to load from config file. The file is optional unless a
+	// profile was asked for, but must be valid if there is one.
+	if err := loadFromFile(config, opts); err != nil {
+		if !errors.Is(err, errNoConfigFile) || opts.Profile != "" {
+			return nil, err
+		}
+		fmt.Printf("Warning: Could not load config file: %v\n", err)
 	}
-	if timeout := os.Getenv("KASM_TIMEOUT"); timeout != "" {
-		// Parse timeout to int and set if valid
+
+	// Then, override with environment variables
+	if err := loadFromEnv(config); err != nil {
+		return nil, err
 	}
-}
 
-func (c *Config) validate() error {
-	if c.APIKey == "" {
-		return fmt.Errorf("API key is required")
+	// Finally, apply overrides
+	before := config.values()
+	for _, override := range overrides {
+		override(config)
 	}
-	if c.APISecret == "" {
-		return fmt.Errorf("API secret is required")
+	for _, f := range config.fields() {
+		if !reflect.DeepEqual(before[f.name], f.value.Interface()) {
+			config.Sources[f.name] = SourceCommandLine
+		}
 	}
-	if c.APIHost == "" {
-		return fmt.Errorf("API host is required")
+
+	// Secrets may be given as references, which are resolved last so they
+	// can come from any layer
+	if err := config.resolveSecrets(); err != nil {
+		return nil, err
 	}
-	return nil
+
+	return config, nil
 }
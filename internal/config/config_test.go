@@ -0,0 +1,361 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets every KASM_ variable for the duration of the test, so the
+// environment the tests run in doesn't leak into the config
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, variable := range os.Environ() {
+		if name, _, _ := strings.Cut(variable, "="); strings.HasPrefix(name, "KASM_") {
+			t.Setenv(name, "")
+		}
+	}
+}
+
+// writeConfig writes a config file named name and returns its path
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const layeredConfig = `{
+	"api_key": "file-key-0123456789",
+	"timeout_seconds": 10,
+	"poll_mode": "adaptive",
+	"defaults": {"timeout_seconds": 20, "poll_backoff": 2},
+	"profiles": {
+		"staging": {"timeout_seconds": 40, "api_host": "https://staging.example.com/api/public"},
+		"prod": {"api_host": "https://kasm.example.com/api/public"}
+	},
+	"default_profile": "staging"
+}`
+
+const layeredYAMLConfig = `
+api_key: file-key-0123456789
+timeout_seconds: 10
+poll_mode: adaptive
+defaults:
+  timeout_seconds: 20
+  poll_backoff: 2
+profiles:
+  staging:
+    timeout_seconds: 40
+    api_host: https://staging.example.com/api/public
+  prod:
+    api_host: https://kasm.example.com/api/public
+default_profile: staging
+`
+
+func TestResolveLayers(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		profile   string
+		env       map[string]string
+		override  func(*Config)
+		timeout   int
+		source    string
+		apiHost   string
+		profileOf string
+	}{
+		{
+			name:      "default profile",
+			file:      "config.json",
+			timeout:   40,
+			source:    SourceProfile + " staging",
+			apiHost:   "https://staging.example.com/api/public",
+			profileOf: "staging",
+		},
+		{
+			name:      "yaml",
+			file:      "config.yaml",
+			timeout:   40,
+			source:    SourceProfile + " staging",
+			apiHost:   "https://staging.example.com/api/public",
+			profileOf: "staging",
+		},
+		{
+			name:      "defaults below the profile",
+			file:      "config.json",
+			profile:   "prod",
+			timeout:   20,
+			source:    SourceDefaults,
+			apiHost:   "https://kasm.example.com/api/public",
+			profileOf: "prod",
+		},
+		{
+			name:      "environment over the file",
+			file:      "config.json",
+			env:       map[string]string{"KASM_TIMEOUT": "50", "KASM_API_HOST": "https://env.example.com/api/public"},
+			timeout:   50,
+			source:    SourceEnv + " KASM_TIMEOUT",
+			apiHost:   "https://env.example.com/api/public",
+			profileOf: "staging",
+		},
+		{
+			name:      "command line over the environment",
+			file:      "config.json",
+			env:       map[string]string{"KASM_TIMEOUT": "50"},
+			override:  func(c *Config) { c.Timeout = 60 },
+			timeout:   60,
+			source:    SourceCommandLine,
+			apiHost:   "https://staging.example.com/api/public",
+			profileOf: "staging",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			content := layeredConfig
+			if filepath.Ext(tt.file) == ".yaml" {
+				content = layeredYAMLConfig
+			}
+			path := writeConfig(t, tt.file, content)
+
+			var overrides []func(*Config)
+			if tt.override != nil {
+				overrides = append(overrides, tt.override)
+			}
+			c, err := Resolve(Options{Path: path, Profile: tt.profile}, overrides...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Timeout != tt.timeout || c.Sources["timeout_seconds"] != tt.source {
+				t.Errorf("timeout_seconds = %d from %q, want %d from %q", c.Timeout, c.Sources["timeout_seconds"], tt.timeout, tt.source)
+			}
+			if c.APIHost != tt.apiHost {
+				t.Errorf("api_host = %q, want %q", c.APIHost, tt.apiHost)
+			}
+			if c.Profile != tt.profileOf {
+				t.Errorf("profile = %q, want %q", c.Profile, tt.profileOf)
+			}
+			// Settings no layer overrides keep the value of the lowest layer
+			// that set them
+			if c.PollMode != PollModeAdaptive || c.Sources["poll_mode"] != SourceFile {
+				t.Errorf("poll_mode = %q from %q, want %q from %q", c.PollMode, c.Sources["poll_mode"], PollModeAdaptive, SourceFile)
+			}
+			if c.PollBackoff != 2 || c.Sources["poll_backoff"] != SourceDefaults {
+				t.Errorf("poll_backoff = %g from %q, want 2 from %q", c.PollBackoff, c.Sources["poll_backoff"], SourceDefaults)
+			}
+			if _, set := c.Sources["destroy_timeout_seconds"]; set || c.DestroyTimeoutSeconds != 300 {
+				t.Errorf("destroy_timeout_seconds = %d from %q, want the default", c.DestroyTimeoutSeconds, c.Sources["destroy_timeout_seconds"])
+			}
+		})
+	}
+}
+
+func TestResolveUnknownProfile(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "config.json", layeredConfig)
+	_, err := Resolve(Options{Path: path, Profile: "dev"})
+	if err == nil || !strings.Contains(err.Error(), `profile "dev" not found`) || !strings.Contains(err.Error(), "prod, staging") {
+		t.Errorf("Resolve() error = %v, want the profile not to be found among prod, staging", err)
+	}
+}
+
+const validConfig = `{
+	"api_key": "key-0123456789",
+	"api_secret": "secret-0123456789",
+	"api_host": "https://kasm.example.com/api/public",
+	"default_image_id": "image"
+}`
+
+// problemFields returns the fields of the problems in err, in order
+func problemFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("error %v is not a *ValidationError", err)
+	}
+	var fields []string
+	for _, problem := range validationErr.Problems {
+		var fieldErr *FieldError
+		if !errors.As(problem, &fieldErr) {
+			t.Fatalf("problem %v is not a *FieldError", problem)
+		}
+		fields = append(fields, fieldErr.Field)
+	}
+	return fields
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		override func(*Config)
+		fields   []string
+		messages []string
+	}{
+		{
+			name: "valid",
+			file: validConfig,
+		},
+		{
+			name:     "missing credentials",
+			file:     `{"api_host": "https://kasm.example.com/api/public", "default_image_id": "image"}`,
+			fields:   []string{"api_key", "api_secret"},
+			messages: []string{"KASM_KEY", "KASM_SECRET"},
+		},
+		{
+			name:     "api host",
+			file:     validConfig,
+			override: func(c *Config) { c.APIHost = "https://kasm.example.com" },
+			fields:   []string{"api_host"},
+			messages: []string{"must end in /api/public, e.g. https://kasm.example.com/api/public"},
+		},
+		{
+			name: "every problem at once",
+			file: validConfig,
+			override: func(c *Config) {
+				c.Timeout = 0
+				c.PollBackoff = 0.5
+				c.TeardownOrder = "sideways"
+			},
+			fields:   []string{"timeout_seconds", "poll_backoff", "teardown_order"},
+			messages: []string{"(from command line)"},
+		},
+		{
+			name:     "reports",
+			file:     validConfig,
+			override: func(c *Config) { c.Reports = []string{"html=report.html", "report.json", "=report.csv"} },
+			fields:   []string{"reports", "reports"},
+			messages: []string{`invalid report "report.json", expected format=path`, `invalid report "=report.csv"`},
+		},
+		{
+			name: "thresholds",
+			file: validConfig,
+			override: func(c *Config) {
+				c.Thresholds = []string{"success_rate >= 99", "failed_sessions", "success_rate => 99"}
+			},
+			fields:   []string{"thresholds", "thresholds"},
+			messages: []string{`invalid threshold "failed_sessions"`, `invalid threshold "success_rate => 99"`},
+		},
+		{
+			name: "unknown settings in every layer",
+			file: `{
+				"api_key": "key-0123456789",
+				"api_secret": "secret-0123456789",
+				"api_host": "https://kasm.example.com/api/public",
+				"default_image_id": "image",
+				"timout_seconds": 10,
+				"defaults": {"poll_intervall_seconds": 5},
+				"profiles": {
+					"a": {"groups": [{"name": "g", "users": ["bob"], "sesions": 2}]},
+					"b": {"log_levl": "debug"}
+				}
+			}`,
+			fields: []string{"timout_seconds", "poll_intervall_seconds", "groups", "log_levl"},
+			messages: []string{
+				`did you mean "timeout_seconds"?`,
+				`defaults (did you mean "poll_interval_seconds"?)`,
+				`"sesions": unknown setting in`,
+				`profile "b" (did you mean "log_level"?)`,
+			},
+		},
+		{
+			name:     "unknown setting without suggestion",
+			file:     `{"api_key": "key-0123456789", "api_secret": "secret-0123456789", "api_host": "https://kasm.example.com/api/public", "default_image_id": "image", "colour": "blue"}`,
+			fields:   []string{"colour"},
+			messages: []string{"unknown setting in"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			path := writeConfig(t, "config.json", tt.file)
+			var overrides []func(*Config)
+			if tt.override != nil {
+				overrides = append(overrides, tt.override)
+			}
+			c, err := Resolve(Options{Path: path}, overrides...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = c.Validate()
+			if fields := problemFields(t, err); !slices.Equal(fields, tt.fields) {
+				t.Fatalf("Validate() problems with %v, want %v: %v", fields, tt.fields, err)
+			}
+			for _, message := range tt.messages {
+				if !strings.Contains(err.Error(), message) {
+					t.Errorf("Validate() error = %v, want it to mention %q", err, message)
+				}
+			}
+		})
+	}
+}
+
+func TestValidationErrorWithout(t *testing.T) {
+	err := &ValidationError{Problems: []error{
+		&FieldError{Field: "default_image_id", Message: "is required"},
+		&FieldError{Field: "sessions", Message: "must not be negative"},
+		errors.New("not a field"),
+	}}
+	// Problems that aren't about a field are always kept
+	var validationErr *ValidationError
+	if !errors.As(err.Without("default_image_id", "sessions"), &validationErr) || len(validationErr.Problems) != 1 {
+		t.Errorf("Without(default_image_id, sessions) = %v, want the problem without a field", err.Without("default_image_id", "sessions"))
+	}
+	if !errors.As(err.Without("sessions"), &validationErr) || len(validationErr.Problems) != 2 {
+		t.Errorf("Without(sessions) = %v, want the other 2 problems", err.Without("sessions"))
+	}
+	if err := (&ValidationError{Problems: []error{&FieldError{Field: "sessions"}}}).Without("sessions"); err != nil {
+		t.Errorf("Without() = %v, want nil", err)
+	}
+}
+
+func TestClosest(t *testing.T) {
+	candidates := []string{"timeout_seconds", "poll_mode", "log_level", "users"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"timout_seconds", "timeout_seconds"},
+		{"poll_mod", "poll_mode"},
+		{"log-level", "log_level"},
+		{"user", "users"},
+		{"colour", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := closest(tt.name, candidates); got != tt.want {
+			t.Errorf("closest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"poll_mode", "poll_mode", 0},
+		{"flaw", "lawn", 2},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
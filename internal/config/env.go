@@ -0,0 +1,142 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envAliases are the environment variables some fields were read from
+// before every field could be set from the environment. They take
+// precedence over the generic names.
+var envAliases = map[string]string{
+	"api_key":         "KASM_KEY",
+	"api_secret":      "KASM_SECRET",
+	"timeout_seconds": "KASM_TIMEOUT",
+}
+
+// EnvName returns the environment variable that sets the field with the
+// given JSON name, e.g. KASM_POLL_MODE for poll_mode
+func EnvName(name string) string {
+	if alias, ok := envAliases[name]; ok {
+		return alias
+	}
+	return "KASM_" + strings.ToUpper(name)
+}
+
+// loadFromEnv overrides every field that has its environment variable set
+func loadFromEnv(config *Config) error {
+	for _, f := range config.fields() {
+		names := []string{EnvName(f.name)}
+		if generic := "KASM_" + strings.ToUpper(f.name); generic != names[0] {
+			names = append(names, generic)
+		}
+		for _, name := range names {
+			value := os.Getenv(name)
+			if value == "" {
+				continue
+			}
+			if err := f.set(value); err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			config.Sources[f.name] = SourceEnv + " " + name
+			break
+		}
+	}
+	return nil
+}
+
+// set parses value into the field. Lists are comma separated, lists of
+// objects are JSON. Times in seconds may also be given as durations, e.g.
+// "5m".
+func (f field) set(value string) error {
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			seconds, ok := f.seconds(value)
+			if !ok {
+				return fmt.Errorf("%q is not an integer", value)
+			}
+			n = int(seconds)
+		}
+		f.value.SetInt(int64(n))
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			seconds, ok := f.seconds(value)
+			if !ok {
+				return fmt.Errorf("%q is not a number", value)
+			}
+			n = seconds
+		}
+		f.value.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		f.value.SetBool(b)
+	case reflect.Slice:
+		if f.value.Type().Elem().Kind() != reflect.String {
+			// Lists of objects, such as groups, are given as JSON
+			items := reflect.New(f.value.Type())
+			if err := json.Unmarshal([]byte(value), items.Interface()); err != nil {
+				return fmt.Errorf("%q is not a JSON list: %w", value, err)
+			}
+			f.value.Set(items.Elem())
+			break
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		// Entries are name=value pairs merged into the map, e.g.
+		// "request_kasm=600,get_kasm_status=10"
+		entries := make(map[string]int)
+		for key, seconds := range f.value.Interface().(map[string]int) {
+			entries[key] = seconds
+		}
+		for _, item := range strings.Split(value, ",") {
+			key, entry, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok {
+				return fmt.Errorf("%q is not a name=value pair", item)
+			}
+			n, err := strconv.Atoi(entry)
+			if err != nil {
+				seconds, ok := f.seconds(entry)
+				if !ok {
+					return fmt.Errorf("%q is not an integer", entry)
+				}
+				n = int(seconds)
+			}
+			entries[key] = n
+		}
+		f.value.Set(reflect.ValueOf(entries))
+	default:
+		return fmt.Errorf("unsupported type %s", f.value.Type())
+	}
+	return nil
+}
+
+// seconds parses a duration given for a field in seconds
+func (f field) seconds(value string) (float64, bool) {
+	if !strings.HasSuffix(f.name, "_seconds") {
+		return 0, false
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, false
+	}
+	return d.Seconds(), true
+}
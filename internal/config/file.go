@@ -0,0 +1,173 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultFileNames are the config files looked for in the home directory,
+// in order
+var defaultFileNames = []string{
+	".kasm-stress-test.json",
+	".kasm-stress-test.yaml",
+	".kasm-stress-test.yml",
+}
+
+// errNoConfigFile is returned when none of the default config files exist
+var errNoConfigFile = errors.New("no config file found")
+
+// fileConfig is the layout of the config file. Besides the fields of Config
+// at the top level, it may hold a defaults section shared by every profile
+// and named profiles, e.g. one per deployment.
+type fileConfig struct {
+	Defaults       json.RawMessage            `json:"defaults"`
+	Profiles       map[string]json.RawMessage `json:"profiles"`
+	DefaultProfile string                     `json:"default_profile"`
+}
+
+func loadFromFile(config *Config, opts Options) error {
+	configPath := opts.Path
+	if configPath == "" {
+		var err error
+		if configPath, err = findConfigFile(); err != nil {
+			return err
+		}
+	}
+
+	data, err := readConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+	config.Path = configPath
+
+	// Layers are decoded on top of each other, so each only overrides the
+	// fields it sets: top level, then defaults, then the profile
+	var file fileConfig
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("could not decode config file %s: %w", configPath, err)
+	}
+
+	// Misspelt settings are reported by Validate rather than silently
+	// ignored, in every profile and not just the selected one
+	type fileLayer struct {
+		source string
+		data   []byte
+		extra  []string
+	}
+	layers := []fileLayer{{configPath, data, []string{"defaults", "profiles", "default_profile"}}}
+	if len(file.Defaults) > 0 {
+		layers = append(layers, fileLayer{configPath + " defaults", file.Defaults, nil})
+	}
+	for _, name := range sortedKeys(file.Profiles) {
+		layers = append(layers, fileLayer{fmt.Sprintf("%s profile %q", configPath, name), file.Profiles[name], nil})
+	}
+	fields := config.fields()
+	for _, l := range layers {
+		problems, err := checkKeys(l.data, l.source, fields, l.extra...)
+		if err != nil {
+			return fmt.Errorf("could not decode %s: %w", l.source, err)
+		}
+		config.unknownKeys = append(config.unknownKeys, problems...)
+		config.unknownKeys = append(config.unknownKeys, checkGroupKeys(l.data, l.source)...)
+	}
+
+	if err := config.decodeLayer(data, SourceFile); err != nil {
+		return fmt.Errorf("could not decode config file: %w", err)
+	}
+	if len(file.Defaults) > 0 {
+		if err := config.decodeLayer(file.Defaults, SourceDefaults); err != nil {
+			return fmt.Errorf("could not decode config defaults: %w", err)
+		}
+	}
+
+	profile := opts.Profile
+	if profile == "" {
+		profile = file.DefaultProfile
+	}
+	if profile == "" {
+		return nil
+	}
+	layer, ok := file.Profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(file.Profiles))
+		for name := range file.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("profile %q not found in %s, available profiles: %s", profile, configPath, strings.Join(names, ", "))
+	}
+	if err := config.decodeLayer(layer, SourceProfile+" "+profile); err != nil {
+		return fmt.Errorf("could not decode profile %q: %w", profile, err)
+	}
+	config.Profile = profile
+
+	return nil
+}
+
+// findConfigFile returns the first of the default config files in the home
+// directory that exists
+func findConfigFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get home directory: %w", err)
+	}
+	for _, name := range defaultFileNames {
+		path := filepath.Join(home, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("could not open config file: %w", err)
+		}
+	}
+	return "", fmt.Errorf("%w, looked for %s in %s", errNoConfigFile, strings.Join(defaultFileNames, ", "), home)
+}
+
+// readConfigFile reads a config file as JSON. YAML files, recognised by
+// their extension, are converted to JSON so both share the JSON field names.
+func readConfigFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var document any
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("could not decode config file %s: %w", path, err)
+		}
+		if document == nil {
+			return []byte("{}"), nil
+		}
+		data, err = json.Marshal(document)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode config file %s: %w", path, err)
+		}
+	}
+	return data, nil
+}
+
+// decodeLayer decodes a JSON object on top of the config and records source
+// as the source of every field it sets
+func (c *Config) decodeLayer(data []byte, source string) error {
+	if err := json.Unmarshal(data, c); err != nil {
+		return err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	for _, f := range c.fields() {
+		if _, ok := keys[f.name]; ok {
+			c.Sources[f.name] = source
+		}
+	}
+	return nil
+}
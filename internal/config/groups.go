@@ -0,0 +1,210 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Group is a set of users that share a session count, image, workload and
+// start delay, so a run can model e.g. many light users next to a few power
+// users. Every user still gets its own runner.
+type Group struct {
+	Name string `json:"name"`
+	// Users may contain ranges such as "light-{1..50}", which expand to
+	// light-1 to light-50
+	Users []string `json:"users"`
+	// Sessions, ImageID and Command default to the run's sessions,
+	// default_image_id and command when they are not set
+	Sessions int    `json:"sessions,omitempty"`
+	ImageID  string `json:"image_id,omitempty"`
+	Command  string `json:"command,omitempty"`
+	// StartDelaySeconds holds back the group's first session, e.g. to let
+	// light users ramp up before power users join
+	StartDelaySeconds int `json:"start_delay_seconds,omitempty"`
+}
+
+// StartDelay returns how long the group's first session is held back
+func (g Group) StartDelay() time.Duration {
+	return time.Duration(g.StartDelaySeconds) * time.Second
+}
+
+// RunGroups returns the groups of users to run with their user ranges
+// expanded and their unset settings defaulted from the config. Without
+// Groups, the Users form a single group without a name.
+func (c *Config) RunGroups() []Group {
+	groups := c.Groups
+	if len(groups) == 0 {
+		if len(c.Users) == 0 {
+			return nil
+		}
+		groups = []Group{{Users: c.Users}}
+	}
+
+	resolved := make([]Group, 0, len(groups))
+	for _, group := range groups {
+		group.Users = expandUsers(group.Users)
+		if group.Sessions == 0 {
+			group.Sessions = c.Sessions
+		}
+		if group.ImageID == "" {
+			group.ImageID = c.DefaultImageID
+		}
+		if group.Command == "" {
+			group.Command = c.Command
+		}
+		resolved = append(resolved, group)
+	}
+	return resolved
+}
+
+// Usernames returns every user of the run, across groups
+func (c *Config) Usernames() []string {
+	var usernames []string
+	for _, group := range c.RunGroups() {
+		usernames = append(usernames, group.Users...)
+	}
+	return usernames
+}
+
+// userRange matches a range of numbers in a username, e.g. {1..50}
+var userRange = regexp.MustCompile(`\{(\d+)\.\.(\d+)\}`)
+
+// maxUserRange is the most users a range may expand to, so a typo such as
+// {1..10000000} is rejected rather than expanded
+const maxUserRange = 10000
+
+// expandUsers expands the first range in each username. Numbers are padded
+// to the width of the range's start when it has leading zeros, so
+// "user{01..10}" expands to user01 to user10.
+func expandUsers(usernames []string) []string {
+	var expanded []string
+	for _, username := range usernames {
+		match := userRange.FindStringSubmatchIndex(username)
+		if match == nil {
+			expanded = append(expanded, username)
+			continue
+		}
+		first, last := username[match[2]:match[3]], username[match[4]:match[5]]
+		from, fromErr := strconv.Atoi(first)
+		to, toErr := strconv.Atoi(last)
+		if fromErr != nil || toErr != nil || to-from >= maxUserRange {
+			// Too large to expand, rejected by validateGroups
+			expanded = append(expanded, username)
+			continue
+		}
+		width := 0
+		if len(first) > 1 && first[0] == '0' {
+			width = len(first)
+		}
+		for n := from; n <= to; n++ {
+			expanded = append(expanded, fmt.Sprintf("%s%0*d%s", username[:match[0]], width, n, username[match[1]:]))
+		}
+	}
+	return expanded
+}
+
+// validateGroups checks the groups and that no user is in two of them
+func (c *Config) validateGroups(v *validator) {
+	if len(c.Groups) == 0 {
+		return
+	}
+	v.check(len(c.Users) == 0, "users", "can't be set with groups, list the users in their groups")
+
+	names := make(map[string]bool)
+	groupOf := make(map[string]string)
+	for i, group := range c.Groups {
+		name := group.Name
+		if name == "" {
+			v.check(false, "groups", "group %d has no name", i+1)
+			name = fmt.Sprintf("%d", i+1)
+		} else {
+			v.check(!names[name], "groups", "group name %q is used twice", name)
+			names[name] = true
+		}
+
+		v.check(len(group.Users) > 0, "groups", "group %s has no users", name)
+		for _, username := range group.Users {
+			if match := userRange.FindStringSubmatch(username); match != nil {
+				from, fromErr := strconv.Atoi(match[1])
+				to, toErr := strconv.Atoi(match[2])
+				v.check(fromErr == nil && toErr == nil && to-from < maxUserRange, "groups",
+					"group %s has the user range %q of more than %d users", name, username, maxUserRange)
+				v.check(fromErr != nil || toErr != nil || from <= to, "groups", "group %s has the empty user range %q", name, username)
+			}
+		}
+		for _, username := range expandUsers(group.Users) {
+			if strings.TrimSpace(username) == "" {
+				v.check(false, "groups", "group %s must not contain empty usernames", name)
+				continue
+			}
+			if other, ok := groupOf[username]; ok && other == name {
+				v.check(false, "groups", "user %s is listed twice in group %s", username, name)
+			} else if ok {
+				v.check(false, "groups", "user %s is in both group %s and group %s", username, other, name)
+			}
+			groupOf[username] = name
+		}
+
+		v.check(group.Sessions >= 0, "groups", "sessions of group %s must not be negative, got %d", name, group.Sessions)
+		switch group.Command {
+		case "", CommandAll, CommandCPU, CommandNetwork:
+		default:
+			v.check(false, "groups", "command of group %s must be %q, %q or %q, got %q", name, CommandCPU, CommandNetwork, CommandAll, group.Command)
+		}
+		v.check(group.StartDelaySeconds >= 0, "groups", "start_delay_seconds of group %s must not be negative, got %d", name, group.StartDelaySeconds)
+		v.check(c.SoakDurationSeconds == 0 || group.StartDelaySeconds < c.SoakDurationSeconds, "groups",
+			"start_delay_seconds of group %s must be less than soak_duration_seconds (%d), or its sessions never start, got %d",
+			name, c.SoakDurationSeconds, group.StartDelaySeconds)
+	}
+}
+
+// needsDefaultImage reports whether some users run the default image,
+// because they are not in a group or their group has no image of its own
+func (c *Config) needsDefaultImage() bool {
+	if len(c.Groups) == 0 {
+		return true
+	}
+	for _, group := range c.Groups {
+		if group.ImageID == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGroupKeys returns a problem for every unknown setting in the groups of
+// a config layer, reported against groups
+func checkGroupKeys(data []byte, source string) []error {
+	var layer struct {
+		Groups []json.RawMessage `json:"groups"`
+	}
+	if err := json.Unmarshal(data, &layer); err != nil {
+		// Left for decoding to report with the rest of the layer
+		return nil
+	}
+
+	t := reflect.TypeOf(Group{})
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+	var problems []error
+	for i, group := range layer.Groups {
+		groupProblems, err := checkKeys(group, fmt.Sprintf("%s group %d", source, i+1), nil, names...)
+		if err != nil {
+			problems = append(problems, &FieldError{Field: "groups", Message: fmt.Sprintf("group %d in %s must be an object", i+1, source)})
+			continue
+		}
+		for _, problem := range groupProblems {
+			fieldErr := problem.(*FieldError)
+			problems = append(problems, &FieldError{Field: "groups", Message: fmt.Sprintf("%q: %s", fieldErr.Field, fieldErr.Message)})
+		}
+	}
+	return problems
+}
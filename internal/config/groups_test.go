@@ -0,0 +1,55 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpandUsers(t *testing.T) {
+	tests := []struct {
+		name      string
+		usernames []string
+		want      []string
+	}{
+		{name: "plain", usernames: []string{"alice", "bob"}, want: []string{"alice", "bob"}},
+		{name: "range", usernames: []string{"light-{1..3}"}, want: []string{"light-1", "light-2", "light-3"}},
+		{name: "padded", usernames: []string{"user{08..10}@example.com"}, want: []string{"user08@example.com", "user09@example.com", "user10@example.com"}},
+		{name: "single", usernames: []string{"power-{5..5}"}, want: []string{"power-5"}},
+		{name: "empty range", usernames: []string{"x{3..1}"}, want: nil},
+		{name: "first range only", usernames: []string{"u{1..2}-{1..2}"}, want: []string{"u1-{1..2}", "u2-{1..2}"}},
+		{name: "too large", usernames: []string{"u{1..10000000}"}, want: []string{"u{1..10000000}"}},
+		{name: "overflowing", usernames: []string{"u{1..99999999999999999999}"}, want: []string{"u{1..99999999999999999999}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandUsers(tt.usernames); !slices.Equal(got, tt.want) {
+				t.Errorf("expandUsers(%q) = %q, want %q", tt.usernames, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		groups   []Group
+		soak     int
+		problems int
+	}{
+		{name: "valid", groups: []Group{{Name: "a", Users: []string{"a{1..3}"}}, {Name: "b", Users: []string{"b"}, StartDelaySeconds: 30}}, soak: 60},
+		{name: "user in two groups", groups: []Group{{Name: "a", Users: []string{"u{1..3}"}}, {Name: "b", Users: []string{"u2"}}}, problems: 1},
+		{name: "range too large", groups: []Group{{Name: "a", Users: []string{"u{1..20000}"}}}, problems: 1},
+		{name: "delay past the soak", groups: []Group{{Name: "a", Users: []string{"u"}, StartDelaySeconds: 60}}, soak: 60, problems: 1},
+		{name: "delay without soak", groups: []Group{{Name: "a", Users: []string{"u"}, StartDelaySeconds: 600}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{Groups: tt.groups, SoakDurationSeconds: tt.soak}
+			v := &validator{config: c}
+			c.validateGroups(v)
+			if len(v.problems) != tt.problems {
+				t.Errorf("validateGroups() found %v, want %d problems", v.problems, tt.problems)
+			}
+		})
+	}
+}
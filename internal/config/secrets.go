@@ -0,0 +1,104 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"kasm-stress-test/internal/utils"
+)
+
+// secretCommandTimeout bounds how long an exec: secret reference may run
+const secretCommandTimeout = 30 * time.Second
+
+// shortSecretLength is the length below which a secret is likely a
+// placeholder. It is still redacted, which mangles every word it occurs in.
+const shortSecretLength = 8
+
+// resolveSecrets replaces secret references in the secret settings with the
+// secrets they point to, and registers the secrets to be redacted from logs,
+// errors and reports
+func (c *Config) resolveSecrets() error {
+	for _, f := range c.fields() {
+		if !secretFields[f.name] {
+			continue
+		}
+		value := f.value.String()
+		secret, err := resolveSecret(value)
+		if err != nil {
+			return &FieldError{Field: f.name, Message: err.Error()}
+		}
+		if secret != value {
+			f.value.SetString(secret)
+			c.Sources[f.name] += " via " + value
+		}
+		if secret != "" && len(secret) < shortSecretLength {
+			fmt.Printf("Warning: %s is shorter than %d characters, every occurrence of it is redacted from the output\n", f.name, shortSecretLength)
+		}
+		utils.RegisterSecret(secret)
+	}
+	return nil
+}
+
+// resolveSecret returns the secret a reference points to. A reference is
+// "file:path", "env:NAME" or "exec:command", whose trimmed output is the
+// secret. Any other value is the secret itself.
+func resolveSecret(value string) (string, error) {
+	kind, ref, _ := strings.Cut(value, ":")
+	var secret string
+	switch kind {
+	case "file":
+		data, err := os.ReadFile(ref)
+		if err != nil {
+			return "", fmt.Errorf("could not read secret file: %w", err)
+		}
+		secret = string(data)
+	case "env":
+		var ok bool
+		if secret, ok = os.LookupEnv(ref); !ok {
+			return "", fmt.Errorf("environment variable %s is not set", ref)
+		}
+	case "exec":
+		output, err := runSecretCommand(ref)
+		if err != nil {
+			return "", err
+		}
+		secret = output
+	default:
+		return value, nil
+	}
+
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return "", fmt.Errorf("secret reference %q resolved to an empty secret", value)
+	}
+	return secret, nil
+}
+
+// runSecretCommand runs command with the system shell and returns its output
+func runSecretCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("secret command %q failed: %w: %s", command, err, message)
+		}
+		return "", fmt.Errorf("secret command %q failed: %w", command, err)
+	}
+	return string(output), nil
+}
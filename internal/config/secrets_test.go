@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("  file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_KASM_SECRET", "env-secret")
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		err   string
+	}{
+		{name: "plain", value: "plain-secret", want: "plain-secret"},
+		{name: "plain with colon", value: "abc:def", want: "abc:def"},
+		{name: "file", value: "file:" + secretFile, want: "file-secret"},
+		{name: "missing file", value: "file:" + filepath.Join(dir, "missing"), err: "could not read secret file"},
+		{name: "empty file", value: "file:" + emptyFile, err: "resolved to an empty secret"},
+		{name: "env", value: "env:TEST_KASM_SECRET", want: "env-secret"},
+		{name: "unset env", value: "env:TEST_KASM_UNSET", err: "TEST_KASM_UNSET is not set"},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, []struct {
+			name  string
+			value string
+			want  string
+			err   string
+		}{
+			{name: "exec", value: "exec:echo exec-secret", want: "exec-secret"},
+			{name: "failing exec", value: "exec:echo oops >&2; exit 3", err: "exit status 3: oops"},
+		}...)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, err := resolveSecret(tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("resolveSecret(%q) error = %v, want %q", tt.value, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveSecret(%q) error = %v", tt.value, err)
+			}
+			if secret != tt.want {
+				t.Errorf("resolveSecret(%q) = %q, want %q", tt.value, secret, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Sources of a setting, see Config.Sources. File sources are followed by
+// the profile name, environment sources by the variable name.
+const (
+	SourceDefault     = "default"
+	SourceFile        = "file"
+	SourceDefaults    = "file defaults"
+	SourceProfile     = "profile"
+	SourceEnv         = "env"
+	SourceCommandLine = "command line"
+)
+
+// secretFields are the settings that are masked when shown
+var secretFields = map[string]bool{
+	"api_key":    true,
+	"api_secret": true,
+}
+
+// Setting is a config value and where it was set
+type Setting struct {
+	// Name is the JSON name of the setting
+	Name   string
+	Value  any
+	Source string
+	// Secret settings should be masked when shown
+	Secret bool
+}
+
+// Settings returns every setting of the config in field order
+func (c *Config) Settings() []Setting {
+	var settings []Setting
+	for _, f := range c.fields() {
+		source, ok := c.Sources[f.name]
+		if !ok {
+			source = SourceDefault
+		}
+		settings = append(settings, Setting{
+			Name:   f.name,
+			Value:  f.value.Interface(),
+			Source: source,
+			Secret: secretFields[f.name],
+		})
+	}
+	return settings
+}
+
+// Mask hides a secret, keeping only its last four characters of longer
+// secrets so it can still be told apart
+func Mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) < 12 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
+
+// field is a Config field that can be set from the config file and the
+// environment
+type field struct {
+	// name is the JSON name of the field
+	name  string
+	value reflect.Value
+}
+
+func (c *Config) fields() []field {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, field{name: name, value: v.Field(i)})
+	}
+	return fields
+}
+
+// values returns a copy of every field's value by JSON name
+func (c *Config) values() map[string]any {
+	values := make(map[string]any)
+	for _, f := range c.fields() {
+		values[f.name] = f.value.Interface()
+	}
+	return values
+}
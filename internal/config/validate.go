@@ -0,0 +1,306 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// logLevels are the supported values for LogLevel
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// logFormats are the supported values for LogFormat
+var logFormats = []string{"text", "json"}
+
+// thresholdSyntax matches the form of a threshold, e.g. "success_rate >= 99"
+var thresholdSyntax = regexp.MustCompile(`^\s*[a-z0-9_]+\s*(>=|<=|==|>|<)\s*\S+\s*$`)
+
+// FieldError is a problem with a single setting
+type FieldError struct {
+	// Field is the JSON name of the setting
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError lists every problem found in a config
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	if len(e.Problems) == 1 {
+		sb.WriteString("1 problem found in the config:")
+	} else {
+		fmt.Fprintf(&sb, "%d problems found in the config:", len(e.Problems))
+	}
+	for _, problem := range e.Problems {
+		sb.WriteString("\n  " + problem.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap returns the problems, so they can be matched with errors.As
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
+
+// Without returns the problems with fields other than the given ones, or nil
+// if there are none. It lets commands that don't use some settings accept a
+// config that is incomplete for a run.
+func (e *ValidationError) Without(fields ...string) error {
+	var problems []error
+	for _, problem := range e.Problems {
+		var fieldErr *FieldError
+		if errors.As(problem, &fieldErr) && slices.Contains(fields, fieldErr.Field) {
+			continue
+		}
+		problems = append(problems, problem)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// validator collects the problems found in a config
+type validator struct {
+	config   *Config
+	problems []error
+}
+
+// check records a problem with field unless ok. The message says where the
+// offending value was set, so it can be found and fixed.
+func (v *validator) check(ok bool, field, format string, args ...any) {
+	if ok {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	if source, set := v.config.Sources[field]; set {
+		message += " (from " + source + ")"
+	}
+	v.problems = append(v.problems, &FieldError{Field: field, Message: message})
+}
+
+// Validate checks that the config is complete and its values are in range.
+// Every problem found is reported in a *ValidationError.
+func (c *Config) Validate() error {
+	v := &validator{config: c}
+
+	v.check(c.APIKey != "", "api_key", "is required, set it in the config file or KASM_KEY")
+	v.check(c.APISecret != "", "api_secret", "is required, set it in the config file or KASM_SECRET")
+	if c.APIHost == "" {
+		v.check(false, "api_host", "is required, set it in the config file or KASM_API_HOST, e.g. https://kasm.example.com/api/public")
+	} else {
+		c.validateAPIHost(v)
+	}
+	v.check(c.DefaultImageID != "" || !c.needsDefaultImage(), "default_image_id", "is required, set it in the config file or KASM_DEFAULT_IMAGE_ID")
+	v.check(slices.Contains(logLevels, strings.ToLower(c.LogLevel)), "log_level", "must be one of %s, got %q", strings.Join(logLevels, ", "), c.LogLevel)
+	v.check(c.LogFile != "", "log_file", "is required, e.g. stress-test.log, or stderr to log to standard error")
+	v.check(!c.LogPerRun || c.LogFile != LogStderr, "log_per_run", "can't be used when log_file is %s", LogStderr)
+	v.check(c.LogMaxSizeMB >= 0, "log_max_size_mb", "must not be negative, got %d", c.LogMaxSizeMB)
+	v.check(c.LogMaxFiles >= 0, "log_max_files", "must not be negative, got %d", c.LogMaxFiles)
+	v.check(slices.Contains(logFormats, c.LogFormat), "log_format", "must be one of %s, got %q", strings.Join(logFormats, ", "), c.LogFormat)
+	v.check(c.Timeout > 0, "timeout_seconds", "must be greater than zero, got %d", c.Timeout)
+	for _, endpoint := range sortedKeys(c.EndpointTimeoutsSeconds) {
+		if !slices.Contains(Endpoints, endpoint) {
+			message := fmt.Sprintf("unknown endpoint %q", endpoint)
+			if suggestion := closest(endpoint, Endpoints); suggestion != "" {
+				message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+			}
+			v.check(false, "endpoint_timeouts_seconds", "%s, endpoints are %s", message, strings.Join(Endpoints, ", "))
+		}
+		seconds := c.EndpointTimeoutsSeconds[endpoint]
+		v.check(seconds > 0, "endpoint_timeouts_seconds", "timeout of %s must be greater than zero, got %d", endpoint, seconds)
+	}
+
+	v.check(c.TLSCertFile == "" || c.TLSKeyFile != "", "tls_key_file", "is required when tls_cert_file is set")
+	v.check(c.TLSKeyFile == "" || c.TLSCertFile != "", "tls_cert_file", "is required when tls_key_file is set")
+	if c.HTTPProxy != "" && c.HTTPProxy != HTTPProxyDirect {
+		u, err := url.Parse(c.HTTPProxy)
+		v.check(err == nil && u.Host != "" && slices.Contains([]string{"http", "https", "socks5"}, u.Scheme), "http_proxy",
+			"must be an http, https or socks5 URL such as http://proxy.example.com:3128, or %q, got %q", HTTPProxyDirect, c.HTTPProxy)
+	}
+	v.check(c.HTTPMaxIdleConnsPerHost > 0, "http_max_idle_conns_per_host", "must be greater than zero, got %d", c.HTTPMaxIdleConnsPerHost)
+	v.check(c.HTTPIdleConnTimeoutSeconds >= 0, "http_idle_conn_timeout_seconds", "must not be negative, got %d", c.HTTPIdleConnTimeoutSeconds)
+
+	v.check(c.PollMode == PollModeFixed || c.PollMode == PollModeAdaptive, "poll_mode", "must be %q or %q, got %q", PollModeFixed, PollModeAdaptive, c.PollMode)
+	v.check(c.PollIntervalSeconds > 0, "poll_interval_seconds", "must be greater than zero, got %g", c.PollIntervalSeconds)
+	v.check(c.PollInitialIntervalSeconds > 0, "poll_initial_interval_seconds", "must be greater than zero, got %g", c.PollInitialIntervalSeconds)
+	v.check(c.PollMaxIntervalSeconds > 0, "poll_max_interval_seconds", "must be greater than zero, got %g", c.PollMaxIntervalSeconds)
+	if c.PollMode == PollModeAdaptive {
+		v.check(c.PollMaxIntervalSeconds >= c.PollInitialIntervalSeconds, "poll_max_interval_seconds",
+			"must be at least poll_initial_interval_seconds (%g), got %g", c.PollInitialIntervalSeconds, c.PollMaxIntervalSeconds)
+	}
+	v.check(c.PollBackoff >= 1, "poll_backoff", "must be at least 1, got %g", c.PollBackoff)
+	v.check(c.ReadyTimeoutSeconds > 0, "ready_timeout_seconds", "must be greater than zero, got %d", c.ReadyTimeoutSeconds)
+	v.check(c.RequestedLimitSeconds > 0, "requested_limit_seconds", "must be greater than zero, got %d", c.RequestedLimitSeconds)
+
+	v.check(c.TeardownWorkers > 0, "teardown_workers", "must be greater than zero, got %d", c.TeardownWorkers)
+	switch c.TeardownOrder {
+	case TeardownOrderFIFO, TeardownOrderLIFO, TeardownOrderRandom, TeardownOrderAgent:
+	default:
+		v.check(false, "teardown_order", "must be %q, %q, %q or %q, got %q",
+			TeardownOrderFIFO, TeardownOrderLIFO, TeardownOrderRandom, TeardownOrderAgent, c.TeardownOrder)
+	}
+	switch c.TeardownProfile {
+	case TeardownProfileBurst:
+	case TeardownProfileRamp, TeardownProfileStep:
+		v.check(c.TeardownDurationSeconds > 0, "teardown_duration_seconds", "must be greater than zero for the %s teardown profile, got %d", c.TeardownProfile, c.TeardownDurationSeconds)
+		if c.TeardownProfile == TeardownProfileStep {
+			v.check(c.TeardownSteps > 0, "teardown_steps", "must be greater than zero, got %d", c.TeardownSteps)
+		}
+	case TeardownProfilePercent:
+		v.check(c.TeardownStepPercent > 0 && c.TeardownStepPercent <= 100, "teardown_step_percent", "must be greater than 0 and at most 100, got %g", c.TeardownStepPercent)
+		v.check(c.TeardownPauseSeconds >= 0, "teardown_pause_seconds", "must not be negative, got %d", c.TeardownPauseSeconds)
+	default:
+		v.check(false, "teardown_profile", "must be %q, %q, %q or %q, got %q",
+			TeardownProfileBurst, TeardownProfileRamp, TeardownProfileStep, TeardownProfilePercent, c.TeardownProfile)
+	}
+	v.check(c.TeardownDurationSeconds >= 0, "teardown_duration_seconds", "must not be negative, got %d", c.TeardownDurationSeconds)
+	v.check(c.DestroyTimeoutSeconds > 0, "destroy_timeout_seconds", "must be greater than zero, got %d", c.DestroyTimeoutSeconds)
+
+	v.check(c.AbortConsecutiveFailures >= 0, "abort_consecutive_failures", "must not be negative, got %d", c.AbortConsecutiveFailures)
+	v.check(c.AbortErrorRate >= 0 && c.AbortErrorRate <= 100, "abort_error_rate", "must be a percentage between 0 and 100, got %g", c.AbortErrorRate)
+	v.check(c.AbortErrorRateWindow >= 0, "abort_error_rate_window", "must not be negative, got %d", c.AbortErrorRateWindow)
+	v.check(c.AbortStuckRequested >= 0, "abort_stuck_requested", "must not be negative, got %d", c.AbortStuckRequested)
+
+	if c.Keepalive {
+		v.check(c.KeepaliveIntervalSeconds > 0, "keepalive_interval_seconds", "must be greater than zero, got %d", c.KeepaliveIntervalSeconds)
+		v.check(c.KeepaliveMarginSeconds > c.KeepaliveIntervalSeconds, "keepalive_margin_seconds",
+			"must be greater than keepalive_interval_seconds (%d), or sessions may expire between checks, got %d", c.KeepaliveIntervalSeconds, c.KeepaliveMarginSeconds)
+	}
+	v.check(c.ReconcileIntervalSeconds >= 0, "reconcile_interval_seconds", "must not be negative, got %d", c.ReconcileIntervalSeconds)
+
+	v.check(c.SoakDurationSeconds >= 0, "soak_duration_seconds", "must not be negative, got %d", c.SoakDurationSeconds)
+	v.check(c.SoakChurnPerHour >= 0, "soak_churn_per_hour", "must not be negative, got %g", c.SoakChurnPerHour)
+	v.check(c.SoakWorkloadIntervalSeconds >= 0, "soak_workload_interval_seconds", "must not be negative, got %d", c.SoakWorkloadIntervalSeconds)
+	v.check(c.SoakSampleIntervalSeconds > 0, "soak_sample_interval_seconds", "must be greater than zero, got %d", c.SoakSampleIntervalSeconds)
+
+	for _, username := range c.Users {
+		v.check(strings.TrimSpace(username) != "", "users", "must not contain empty usernames")
+	}
+	c.validateGroups(v)
+	v.check(c.Sessions >= 0, "sessions", "must not be negative, got %d", c.Sessions)
+	switch c.Command {
+	case CommandAll, CommandCPU, CommandNetwork:
+	default:
+		v.check(false, "command", "must be %q, %q or %q, got %q", CommandCPU, CommandNetwork, CommandAll, c.Command)
+	}
+	// Only the form of reports and thresholds is checked here, their formats
+	// and metrics are checked when they are parsed for a run
+	for _, spec := range c.Reports {
+		format, path, ok := strings.Cut(spec, "=")
+		v.check(ok && format != "" && path != "", "reports", "invalid report %q, expected format=path", spec)
+	}
+	for _, expr := range c.Thresholds {
+		v.check(thresholdSyntax.MatchString(expr), "thresholds", "invalid threshold %q, expected e.g. 'success_rate >= 99'", expr)
+	}
+
+	// Unknown settings found while loading the config file are reported
+	// with the rest
+	v.problems = append(v.problems, c.unknownKeys...)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// validateAPIHost checks that the API host is the URL of a Kasm public API,
+// e.g. https://kasm.example.com/api/public
+func (c *Config) validateAPIHost(v *validator) {
+	u, err := url.Parse(c.APIHost)
+	if err != nil {
+		v.check(false, "api_host", "is not a valid URL: %v", err)
+		return
+	}
+	v.check(u.Scheme == "http" || u.Scheme == "https", "api_host", "must start with https:// or http://, got %q", c.APIHost)
+	v.check(u.Host != "", "api_host", "must include a host name, got %q", c.APIHost)
+	v.check(u.RawQuery == "" && u.Fragment == "", "api_host", "must not have a query or fragment, got %q", c.APIHost)
+	if u.Host != "" && !strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), "/api/public") {
+		scheme := u.Scheme
+		if scheme != "http" {
+			scheme = "https"
+		}
+		v.check(false, "api_host", "must end in /api/public, e.g. %s://%s/api/public, got %q", scheme, u.Host, c.APIHost)
+	}
+}
+
+// checkKeys returns a problem for every key of the JSON object in data that
+// isn't a setting or one of extra, suggesting the setting that was likely
+// meant. The problems are reported against the unknown keys.
+func checkKeys(data []byte, source string, fields []field, extra ...string) ([]error, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	known := append([]string(nil), extra...)
+	for _, f := range fields {
+		known = append(known, f.name)
+	}
+
+	var problems []error
+	for _, key := range sortedKeys(keys) {
+		if slices.Contains(known, key) {
+			continue
+		}
+		message := "unknown setting in " + source
+		if suggestion := closest(key, known); suggestion != "" {
+			message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+		problems = append(problems, &FieldError{Field: key, Message: message})
+	}
+	return problems, nil
+}
+
+// closest returns the candidate nearest to name, if it is close enough to be
+// a likely typo
+func closest(name string, candidates []string) string {
+	best, bestDistance := "", len(name)/3+1
+	for _, candidate := range candidates {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Metrics exposed by the stress test
+var (
+	SessionsByState = NewGaugeVec("kasm_stress_sessions",
+		"Number of sessions currently in each state", "user", "state")
+	TimeToRunning = NewHistogramVec("kasm_stress_time_to_running_seconds",
+		"Time from requesting a Kasm until it reports running",
+		[]float64{5, 10, 15, 20, 30, 45, 60, 90, 120, 180, 300, 600}, "user")
+	APIRequestDuration = NewHistogramVec("kasm_stress_api_request_duration_seconds",
+		"Latency of Kasm API calls",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}, "endpoint")
+	APIErrors = NewCounterVec("kasm_stress_api_errors_total",
+		"Kasm API calls that failed", "endpoint")
+	APITimeouts = NewCounterVec("kasm_stress_api_timeouts_total",
+		"Kasm API calls that exceeded their endpoint's timeout", "endpoint")
+	Retries = NewCounterVec("kasm_stress_retries_total",
+		"Operations that were retried", "operation")
+)
+
+var (
+	stateMutex    sync.Mutex
+	sessionStates = make(map[string]string)
+)
+
+// SetSessionState moves a session to a new state, keeping SessionsByState in sync
+func SetSessionState(username string, sessionNumber int, state string) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	key := fmt.Sprintf("%s/%d", username, sessionNumber)
+	if previous, ok := sessionStates[key]; ok {
+		if previous == state {
+			return
+		}
+		SessionsByState.Add(-1, username, previous)
+	}
+	sessionStates[key] = state
+	SessionsByState.Add(1, username, state)
+}
+
+// ObserveAPICall records the latency and outcome of a Kasm API call
+func ObserveAPICall(endpoint string, duration time.Duration, err error) {
+	APIRequestDuration.Observe(duration.Seconds(), endpoint)
+	if err != nil {
+		APIErrors.Inc(endpoint)
+	}
+}
+
+// Serve starts an HTTP server exposing /metrics on addr in the background.
+// It returns once the listener is open so that bind errors are reported.
+func Serve(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+
+	return server, nil
+}
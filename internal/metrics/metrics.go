@@ -0,0 +1,259 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// collector is implemented by every metric type so the registry can render it
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      []collector
+)
+
+func register(c collector) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry = append(registry, c)
+}
+
+// Handler returns an http.Handler that serves all registered metrics in the
+// Prometheus text exposition format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registryMutex.Lock()
+		defer registryMutex.Unlock()
+		for _, c := range registry {
+			c.write(w)
+		}
+	})
+}
+
+// vec holds the label names and per-label-set values shared by all metric types
+type vec[T any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	mutex  sync.Mutex
+	series map[string]*series[T]
+	create func() T
+}
+
+type series[T any] struct {
+	labelValues []string
+	value       T
+}
+
+func newVec[T any](name, help, kind string, labels []string, create func() T) *vec[T] {
+	return &vec[T]{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*series[T]),
+		create: create,
+	}
+}
+
+// with returns the value for the given label values, creating it if needed.
+// The caller must hold v.mutex.
+func (v *vec[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series[T]{labelValues: append([]string(nil), labelValues...), value: v.create()}
+		v.series[key] = s
+	}
+	return &s.value
+}
+
+// each calls fn for every series in a stable order. The caller must hold v.mutex.
+func (v *vec[T]) each(fn func(labelValues []string, value *T)) {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := v.series[key]
+		fn(s.labelValues, &s.value)
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines of v and reports whether it
+// did. Metrics without any series, e.g. API timeouts while no call has timed
+// out, are left out of the exposition.
+func (v *vec[T]) writeHeader(w io.Writer) bool {
+	if len(v.series) == 0 {
+		return false
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+	return true
+}
+
+// labelEscaper escapes label values as the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders names and values as {a="1",b="2"}, with extra
+// name/value pairs appended
+func formatLabels(names, values []string, extra ...string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// CounterVec is a set of monotonically increasing counters partitioned by labels
+type CounterVec struct {
+	*vec[float64]
+}
+
+// NewCounterVec creates and registers a CounterVec
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels, func() float64 { return 0 })}
+	register(c)
+	return c
+}
+
+// Inc increments the counter for the given label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the given label values by delta
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	*c.with(labelValues) += delta
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.writeHeader(w) {
+		return
+	}
+	c.each(func(labelValues []string, value *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, labelValues), formatFloat(*value))
+	})
+}
+
+// GaugeVec is a set of values that can go up and down, partitioned by labels
+type GaugeVec struct {
+	*vec[float64]
+}
+
+// NewGaugeVec creates and registers a GaugeVec
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, "gauge", labels, func() float64 { return 0 })}
+	register(g)
+	return g
+}
+
+// Set sets the gauge for the given label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	*g.with(labelValues) = value
+}
+
+// Add adds delta (which may be negative) to the gauge for the given label values
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	*g.with(labelValues) += delta
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if !g.writeHeader(w) {
+		return
+	}
+	g.each(func(labelValues []string, value *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, labelValues), formatFloat(*value))
+	})
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a set of histograms with fixed buckets, partitioned by labels
+type HistogramVec struct {
+	*vec[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec creates and registers a HistogramVec with the given upper
+// bucket bounds, which must be sorted in increasing order
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		vec:     newVec(name, help, "histogram", labels, func() histogram { return histogram{counts: make([]uint64, len(buckets))} }),
+		buckets: buckets,
+	}
+	register(h)
+	return h
+}
+
+// Observe records a value in the histogram for the given label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	hist := h.with(labelValues)
+	for i, bound := range h.buckets {
+		if value <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += value
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.writeHeader(w) {
+		return
+	}
+	h.each(func(labelValues []string, hist *histogram) {
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, labelValues, "le", formatFloat(bound)), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, labelValues, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, labelValues), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, labelValues), hist.count)
+	})
+}
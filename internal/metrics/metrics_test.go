@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func() collector
+		want  string
+	}{
+		{
+			name: "counter",
+			setup: func() collector {
+				c := NewCounterVec("test_requests_total", "Requests made", "endpoint", "status")
+				c.Inc("request_kasm", "ok")
+				c.Add(2, "request_kasm", "ok")
+				c.Inc("destroy_kasm", "error")
+				return c
+			},
+			want: `# HELP test_requests_total Requests made
+# TYPE test_requests_total counter
+test_requests_total{endpoint="destroy_kasm",status="error"} 1
+test_requests_total{endpoint="request_kasm",status="ok"} 3
+`,
+		},
+		{
+			name: "gauge without labels",
+			setup: func() collector {
+				g := NewGaugeVec("test_live_sessions", "Live sessions")
+				g.Set(5)
+				g.Add(-1.5)
+				return g
+			},
+			want: `# HELP test_live_sessions Live sessions
+# TYPE test_live_sessions gauge
+test_live_sessions 3.5
+`,
+		},
+		{
+			name: "histogram",
+			setup: func() collector {
+				h := NewHistogramVec("test_duration_seconds", "Durations", []float64{1, 5}, "user")
+				h.Observe(0.5, "alice")
+				h.Observe(3, "alice")
+				h.Observe(10, "alice")
+				return h
+			},
+			want: `# HELP test_duration_seconds Durations
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{user="alice",le="1"} 1
+test_duration_seconds_bucket{user="alice",le="5"} 2
+test_duration_seconds_bucket{user="alice",le="+Inf"} 3
+test_duration_seconds_sum{user="alice"} 13.5
+test_duration_seconds_count{user="alice"} 3
+`,
+		},
+		{
+			name: "label values escaped",
+			setup: func() collector {
+				g := NewGaugeVec("test_escaped", "Escaped labels", "user")
+				g.Set(1, "a\"b\\c\nd")
+				return g
+			},
+			want: `# HELP test_escaped Escaped labels
+# TYPE test_escaped gauge
+test_escaped{user="a\"b\\c\nd"} 1
+`,
+		},
+		{
+			name: "no series",
+			setup: func() collector {
+				return NewGaugeVec("test_empty", "Never set", "node")
+			},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			tt.setup().write(&sb)
+			if sb.String() != tt.want {
+				t.Errorf("exposition =\n%s\nwant\n%s", sb.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	NewCounterVec("test_handler_total", "Served by the handler").Inc()
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	if !strings.Contains(recorder.Body.String(), "test_handler_total 1\n") {
+		t.Errorf("body doesn't hold the counter:\n%s", recorder.Body.String())
+	}
+}
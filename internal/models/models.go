@@ -46,6 +46,7 @@ type KasmStatus struct {
 		ContainerID       string `json:"container_id"`
 		UserID            string `json:"user_id"`
 		ImageID           string `json:"image_id"`
+		ServerID          string `json:"server_id"`
 		StartDate         string `json:"start_date"`
 		ExpirationDate    string `json:"expiration_date"`
 		ContainerIP       string `json:"container_ip"`
@@ -54,6 +55,25 @@ type KasmStatus struct {
 	KasmURL     string `json:"kasm_url"`
 }
 
+// KasmInfo describes a session as listed by get_kasms
+type KasmInfo struct {
+	KasmID            string `json:"kasm_id"`
+	UserID            string `json:"user_id"`
+	ImageID           string `json:"image_id"`
+	OperationalStatus string `json:"operational_status"`
+	ServerID          string `json:"server_id"`
+	StartDate         string `json:"start_date"`
+	ExpirationDate    string `json:"expiration_date"`
+	User              struct {
+		Username string `json:"username"`
+	} `json:"user"`
+}
+
+// KasmsResponse represents the API response for get_kasms
+type KasmsResponse struct {
+	Kasms []KasmInfo `json:"kasms"`
+}
+
 // CommandResult represents the result of an executed command
 type CommandResult struct {
 	KasmID     string `json:"kasm_id"`
@@ -65,29 +85,179 @@ type CommandResult struct {
 
 // StressTestResult represents the result of a stress test
 type StressTestResult struct {
-	Username         string
-	TotalKasms       int
-	SuccessfulKasms  int
-	FailedKasms      int
-	AverageStartTime time.Duration
-	TotalDuration    time.Duration
-	Errors           []string
-	KasmResults      []KasmResult
+	Username string `json:"username"`
+	// Group is the group of users the user was run in
+	Group            string        `json:"group,omitempty"`
+	TotalKasms       int           `json:"total_kasms"`
+	SuccessfulKasms  int           `json:"successful_kasms"`
+	FailedKasms      int           `json:"failed_kasms"`
+	AverageStartTime time.Duration `json:"average_start_time_ns"`
+	TotalDuration    time.Duration `json:"total_duration_ns"`
+	Errors           []string      `json:"errors"`
+	KasmResults      []KasmResult  `json:"kasm_results"`
+	DestroyFailures  int           `json:"destroy_failures"`
+	// Aborted is set when the run was aborted before all sessions were created
+	Aborted bool `json:"aborted,omitempty"`
+	// SoakSamples is the time series recorded during a soak run
+	SoakSamples []SoakSample `json:"soak_samples,omitempty"`
+	// APITimeouts counts the API calls that exceeded their endpoint's
+	// timeout, by endpoint
+	APITimeouts map[string]int `json:"api_timeouts,omitempty"`
+}
+
+// SoakSample summarises one sample interval of a soak run for a single user
+type SoakSample struct {
+	// Time is the end of the interval
+	Time             time.Time `json:"time"`
+	LiveSessions     int       `json:"live_sessions"`
+	Started          int       `json:"started"`
+	Failed           int       `json:"failed"`
+	Destroyed        int       `json:"destroyed"`
+	DestroyFailures  int       `json:"destroy_failures"`
+	WorkloadRuns     int       `json:"workload_runs"`
+	WorkloadFailures int       `json:"workload_failures"`
+	// Time to running of the sessions that started successfully in the interval
+	MeanTimeToRunning time.Duration `json:"mean_time_to_running_ns"`
+	P95TimeToRunning  time.Duration `json:"p95_time_to_running_ns"`
+}
+
+// SoakSettings records how a soak run was configured
+type SoakSettings struct {
+	Duration time.Duration `json:"duration_ns"`
+	// TargetSessions is the number of sessions kept live across every user
+	// and group, see GroupSettings for the sessions of each user
+	TargetSessions   int           `json:"target_sessions"`
+	ChurnPerHour     float64       `json:"churn_per_hour"`
+	WorkloadInterval time.Duration `json:"workload_interval_ns"`
+	SampleInterval   time.Duration `json:"sample_interval_ns"`
+}
+
+// GroupSettings records how a group of users was configured
+type GroupSettings struct {
+	Name       string        `json:"name"`
+	Users      []string      `json:"users"`
+	Sessions   int           `json:"sessions"`
+	ImageID    string        `json:"image_id"`
+	Command    string        `json:"command"`
+	StartDelay time.Duration `json:"start_delay_ns,omitempty"`
+}
+
+// RunResult collects the results of every user in a single stress test run
+type RunResult struct {
+	RunID      string `json:"run_id"`
+	Deployment string `json:"deployment"`
+	// Profile is the config profile the run was made with, if any
+	Profile    string    `json:"profile,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Command    string    `json:"command"`
+	// Groups are the groups the users were run in
+	Groups  []GroupSettings     `json:"groups,omitempty"`
+	Results []*StressTestResult `json:"results"`
+	// AbortReason explains why the run was aborted early, if it was
+	AbortReason string `json:"abort_reason,omitempty"`
+	// Thresholds are the evaluated pass/fail thresholds, if any were set
+	Thresholds []ThresholdResult `json:"thresholds,omitempty"`
+	// Soak is set when the run was a soak run
+	Soak *SoakSettings `json:"soak,omitempty"`
+	// Teardown describes how the sessions were destroyed
+	Teardown *TeardownSummary `json:"teardown,omitempty"`
+	// Reconciliation compares the sessions on the deployment with the
+	// sessions the run created
+	Reconciliation Reconciliation `json:"reconciliation"`
+}
+
+// TeardownSummary describes how the sessions of a run were destroyed
+type TeardownSummary struct {
+	Profile    string    `json:"profile"`
+	Order      string    `json:"order"`
+	Workers    int       `json:"workers"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Destroyed  int       `json:"destroyed"`
+	Failed     int       `json:"failed"`
+	// Steps are the batches of sessions teardown was paced in, to be read
+	// alongside the node counts of the deployment
+	Steps []TeardownStep `json:"steps"`
+}
+
+// TeardownStep is a batch of sessions handed to the teardown workers
+type TeardownStep struct {
+	Time      time.Time `json:"time"`
+	Sessions  int       `json:"sessions"`
+	Remaining int       `json:"remaining"`
+}
+
+// Reconciliation records sessions on the deployment that the run didn't
+// account for
+type Reconciliation struct {
+	// PreExisting are the sessions already on the deployment when the run
+	// started
+	PreExisting []KasmInfo `json:"pre_existing"`
+	// Vanished are the IDs of sessions created by the run that disappeared
+	// from the deployment before they were destroyed
+	Vanished []string `json:"vanished"`
+	// Remaining are the sessions created by the run that were still on the
+	// deployment after they were destroyed
+	Remaining []KasmInfo `json:"remaining"`
+	// Errors are the inventories that could not be taken
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ThresholdResult is the outcome of evaluating a single threshold against a run
+type ThresholdResult struct {
+	Threshold string `json:"threshold"`
+	Actual    string `json:"actual"`
+	Passed    bool   `json:"passed"`
 }
 
 // KasmResult stores individual results for each Kasm instance
 type KasmResult struct {
-	KasmNumber     int
-	KasmID         string
-	StartTime      time.Duration
-	ExecutionError string
+	KasmNumber int    `json:"kasm_number"`
+	KasmID     string `json:"kasm_id"`
+	ImageID    string `json:"image_id"`
+	// ServerID is the agent the session ran on
+	ServerID  string    `json:"server_id,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	// Time spent in each phase of the session
+	RequestDuration time.Duration `json:"request_duration_ns"`
+	ReadyDuration   time.Duration `json:"ready_duration_ns"`
+	ExecDuration    time.Duration `json:"exec_duration_ns"`
+	StartTime       time.Duration `json:"start_time_ns"`
+	// StartTimeResolution is the gap between the two status polls that
+	// bracket the Kasm becoming ready, i.e. the uncertainty of StartTime
+	StartTimeResolution time.Duration `json:"start_time_resolution_ns"`
+	ExecutionError      string        `json:"execution_error,omitempty"`
+	// FailureType classifies ExecutionError, see the Failure* constants
+	FailureType string `json:"failure_type,omitempty"`
+	// TimeToDestroyed is the time from the destroy call until the session
+	// was gone, measured when destruction is verified, with the gap between
+	// the polls that bracket it as its resolution
+	TimeToDestroyed           time.Duration `json:"time_to_destroyed_ns,omitempty"`
+	TimeToDestroyedResolution time.Duration `json:"time_to_destroyed_resolution_ns,omitempty"`
+	// StillPresent is set when the session had not disappeared by the
+	// destroy timeout
+	StillPresent bool `json:"still_present,omitempty"`
+	// Teardown of the session: when the destroy call was made, if it was,
+	// how long it took including retries and why it failed, if it did
+	DestroyStartedAt *time.Time    `json:"destroy_started_at,omitempty"`
+	DestroyDuration  time.Duration `json:"destroy_duration_ns,omitempty"`
+	DestroyError     string        `json:"destroy_error,omitempty"`
+	// TimedOutEndpoint is the API endpoint whose timeout failed the session,
+	// if a timeout did
+	TimedOutEndpoint string `json:"timed_out_endpoint,omitempty"`
 }
 
-// AutoscalingStatus represents the status of the autoscaling system
-type AutoscalingStatus struct {
-	CurrentNodes int     `json:"current_nodes"`
-	DesiredNodes int     `json:"desired_nodes"`
-	PendingNodes int     `json:"pending_nodes"`
-	MaxNodes     int     `json:"max_nodes"`
-	CurrentLoad  float64 `json:"current_load"`
-}
+// Failure types recorded in KasmResult.FailureType
+const (
+	FailureRequest      = "request_failed"
+	FailureNotReady     = "ready_failed"
+	FailureReadyTimeout = "ready_timeout"
+	FailureExec         = "exec_failed"
+	// FailureExpired is recorded for a session that expired before it was
+	// destroyed, despite being kept alive
+	FailureExpired = "expired"
+	// FailureVanished is recorded for a session that disappeared from the
+	// deployment before it was destroyed, without having expired
+	FailureVanished = "vanished"
+)
@@ -0,0 +1,76 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"kasm-stress-test/internal/models"
+)
+
+var csvHeader = []string{
+	"run_id",
+	"user",
+	"group",
+	"session_number",
+	"kasm_id",
+	"image_id",
+	"server_id",
+	"request_seconds",
+	"ready_seconds",
+	"exec_seconds",
+	"start_time_seconds",
+	"start_time_resolution_seconds",
+	"destroy_seconds",
+	"destroy_error",
+	"time_to_destroyed_seconds",
+	"still_present",
+	"timed_out_endpoint",
+	"success",
+	"error",
+}
+
+// writeCSV writes one row per session
+func writeCSV(w io.Writer, run *models.RunResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, result := range run.Results {
+		for _, kasmResult := range result.KasmResults {
+			record := []string{
+				run.RunID,
+				result.Username,
+				result.Group,
+				fmt.Sprint(kasmResult.KasmNumber),
+				kasmResult.KasmID,
+				kasmResult.ImageID,
+				kasmResult.ServerID,
+				seconds(kasmResult.RequestDuration),
+				seconds(kasmResult.ReadyDuration),
+				seconds(kasmResult.ExecDuration),
+				seconds(kasmResult.StartTime),
+				seconds(kasmResult.StartTimeResolution),
+				seconds(kasmResult.DestroyDuration),
+				kasmResult.DestroyError,
+				seconds(kasmResult.TimeToDestroyed),
+				fmt.Sprint(kasmResult.StillPresent),
+				kasmResult.TimedOutEndpoint,
+				fmt.Sprint(kasmResult.ExecutionError == ""),
+				kasmResult.ExecutionError,
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,68 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"kasm-stress-test/internal/models"
+)
+
+func TestWriteCSV(t *testing.T) {
+	run := &models.RunResult{
+		RunID: "run-1",
+		Results: []*models.StressTestResult{{
+			Username: "alice",
+			Group:    "a, b",
+			KasmResults: []models.KasmResult{
+				{KasmNumber: 1, KasmID: "k1", ImageID: "img1", StartTime: 1500 * time.Millisecond},
+				{KasmNumber: 2, ExecutionError: "Failed to request Kasm: \"quota\", exceeded\nretry later"},
+			},
+		}},
+	}
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, run); err != nil {
+		t.Fatal(err)
+	}
+	// Fields with commas, quotes or line breaks are quoted, and quotes
+	// doubled
+	if !strings.Contains(buf.String(), `"a, b"`) || !strings.Contains(buf.String(), `"Failed to request Kasm: ""quota"", exceeded`+"\nretry later\"") {
+		t.Errorf("writeCSV() = %s, want quoted fields", buf.String())
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("writeCSV() wrote %d records, want a header and 2 sessions", len(records))
+	}
+	fields := func(record []string) map[string]string {
+		m := make(map[string]string)
+		for i, name := range records[0] {
+			m[name] = record[i]
+		}
+		return m
+	}
+	tests := []struct {
+		record int
+		field  string
+		want   string
+	}{
+		{1, "run_id", "run-1"},
+		{1, "group", "a, b"},
+		{1, "session_number", "1"},
+		{1, "start_time_seconds", "1.500"},
+		{1, "success", "true"},
+		{1, "error", ""},
+		{2, "success", "false"},
+		{2, "error", "Failed to request Kasm: \"quota\", exceeded\nretry later"},
+	}
+	for _, tt := range tests {
+		if got := fields(records[tt.record])[tt.field]; got != tt.want {
+			t.Errorf("record %d %s = %q, want %q", tt.record, tt.field, got, tt.want)
+		}
+	}
+}
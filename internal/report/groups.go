@@ -0,0 +1,84 @@
+package report
+
+import (
+	"sort"
+	"time"
+
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/stats"
+)
+
+// GroupSummary is the outcome of the sessions of one group of users
+type GroupSummary struct {
+	Name            string
+	Users           int
+	Sessions        int
+	Successful      int
+	Failed          int
+	DestroyFailures int
+	// Time to running of the sessions that started successfully
+	MeanTimeToRunning time.Duration
+	P95TimeToRunning  time.Duration
+	// Settings is how the group was configured, nil for results of runs
+	// that didn't record it
+	Settings *models.GroupSettings
+}
+
+// SuccessRate returns the percentage of the group's sessions that succeeded
+func (g GroupSummary) SuccessRate() float64 {
+	if g.Sessions == 0 {
+		return 0
+	}
+	return float64(g.Successful) / float64(g.Sessions) * 100
+}
+
+// Groups summarises the results of each group of users, in the order the
+// groups were configured. Results without a group, from runs without groups,
+// are left out.
+func Groups(run *models.RunResult) []GroupSummary {
+	byName := make(map[string]*GroupSummary)
+	startTimes := make(map[string][]float64)
+	var names []string
+	for i := range run.Groups {
+		settings := &run.Groups[i]
+		byName[settings.Name] = &GroupSummary{Name: settings.Name, Settings: settings}
+		names = append(names, settings.Name)
+	}
+
+	var unconfigured []string
+	for _, result := range run.Results {
+		if result.Group == "" {
+			continue
+		}
+		group, ok := byName[result.Group]
+		if !ok {
+			group = &GroupSummary{Name: result.Group}
+			byName[result.Group] = group
+			unconfigured = append(unconfigured, result.Group)
+		}
+		group.Users++
+		group.DestroyFailures += result.DestroyFailures
+		for _, kasmResult := range result.KasmResults {
+			group.Sessions++
+			if kasmResult.ExecutionError == "" {
+				group.Successful++
+				startTimes[result.Group] = append(startTimes[result.Group], kasmResult.StartTime.Seconds())
+			} else {
+				group.Failed++
+			}
+		}
+	}
+	sort.Strings(unconfigured)
+	names = append(names, unconfigured...)
+
+	summaries := make([]GroupSummary, 0, len(names))
+	for _, name := range names {
+		group := byName[name]
+		if times := startTimes[name]; len(times) > 0 {
+			group.MeanTimeToRunning = time.Duration(stats.Mean(times) * float64(time.Second))
+			group.P95TimeToRunning = time.Duration(stats.Percentile(times, 95) * float64(time.Second))
+		}
+		summaries = append(summaries, *group)
+	}
+	return summaries
+}
@@ -0,0 +1,452 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/stats"
+)
+
+// Chart dimensions in pixels
+const (
+	chartLabelWidth = 180
+	chartWidth      = 800
+	timelineRowSize = 18
+	histogramHeight = 200
+	histogramBins   = 20
+)
+
+type htmlView struct {
+	Run         *models.RunResult
+	Duration    string
+	Sessions    int
+	Successful  int
+	Failed      int
+	SuccessRate string
+	Latency     []htmlStat
+	Teardown    []htmlStat
+	// StillPresent lists the sessions that never disappeared after they
+	// were destroyed
+	StillPresent []string
+	Timeline     htmlTimeline
+	Histogram    htmlHistogram
+	Failures     []htmlFailure
+	// Groups summarises each group of users, if the run had groups
+	Groups []GroupSummary
+	// APITimeouts counts the API calls that timed out by endpoint
+	APITimeouts []htmlTimeout
+}
+
+type htmlStat struct {
+	Name  string
+	Value string
+}
+
+type htmlTimeline struct {
+	Width  int
+	Height int
+	Rows   []htmlTimelineRow
+	Ticks  []htmlTick
+}
+
+type htmlTimelineRow struct {
+	Label    string
+	Y        int
+	Segments []htmlSegment
+	Outline  *htmlSegment
+	Title    string
+}
+
+type htmlSegment struct {
+	X, Width float64
+	Class    string
+}
+
+type htmlTick struct {
+	X     float64
+	Label string
+}
+
+type htmlHistogram struct {
+	Width  int
+	Height int
+	Bars   []htmlBar
+	Ticks  []htmlTick
+	Empty  bool
+}
+
+type htmlBar struct {
+	X, Y, Width, Height float64
+	Title               string
+}
+
+type htmlFailure struct {
+	Type     string
+	Count    int
+	Examples []string
+}
+
+type htmlTimeout struct {
+	Endpoint string
+	Count    int
+}
+
+// writeHTML writes a self-contained HTML report with inline SVG charts
+func writeHTML(w io.Writer, run *models.RunResult) error {
+	view := htmlView{Run: run}
+
+	var startTimes, destroyTimes []float64
+	for _, result := range run.Results {
+		for _, kasmResult := range result.KasmResults {
+			if kasmResult.TimeToDestroyed > 0 {
+				destroyTimes = append(destroyTimes, kasmResult.TimeToDestroyed.Seconds())
+			}
+			if kasmResult.StillPresent {
+				view.StillPresent = append(view.StillPresent, fmt.Sprintf("%s (%s #%d)", kasmResult.KasmID, result.Username, kasmResult.KasmNumber))
+			}
+			view.Sessions++
+			if kasmResult.ExecutionError == "" {
+				view.Successful++
+				startTimes = append(startTimes, kasmResult.StartTime.Seconds())
+			} else {
+				view.Failed++
+			}
+		}
+	}
+	if view.Sessions > 0 {
+		view.SuccessRate = fmt.Sprintf("%.1f%%", float64(view.Successful)/float64(view.Sessions)*100)
+	}
+	view.Duration = run.FinishedAt.Sub(run.StartedAt).Round(time.Second).String()
+
+	view.Latency = durationStats(startTimes)
+	view.Teardown = durationStats(destroyTimes)
+
+	view.Timeline = buildTimeline(run)
+	view.Histogram = buildHistogram(startTimes)
+	view.Failures = buildFailures(run)
+	view.APITimeouts = buildAPITimeouts(run)
+	view.Groups = Groups(run)
+
+	return htmlTemplate.Execute(w, view)
+}
+
+// durationStats summarises durations in seconds, or returns nil if there are
+// none
+func durationStats(durations []float64) []htmlStat {
+	if len(durations) == 0 {
+		return nil
+	}
+	return []htmlStat{
+		{"Mean", fmt.Sprintf("%.1fs", stats.Mean(durations))},
+		{"p50", fmt.Sprintf("%.1fs", stats.Percentile(durations, 50))},
+		{"p90", fmt.Sprintf("%.1fs", stats.Percentile(durations, 90))},
+		{"p95", fmt.Sprintf("%.1fs", stats.Percentile(durations, 95))},
+		{"p99", fmt.Sprintf("%.1fs", stats.Percentile(durations, 99))},
+		{"Max", fmt.Sprintf("%.1fs", stats.Percentile(durations, 100))},
+	}
+}
+
+func buildTimeline(run *models.RunResult) htmlTimeline {
+	timeline := htmlTimeline{Width: chartLabelWidth + chartWidth + 20}
+
+	// Scale to the sessions themselves rather than the whole run, which
+	// includes waiting for the user before teardown
+	start := run.StartedAt
+	end := start
+	for _, result := range run.Results {
+		for _, kasmResult := range result.KasmResults {
+			finished := kasmResult.StartedAt.Add(kasmResult.RequestDuration + kasmResult.ReadyDuration + kasmResult.ExecDuration)
+			if finished.After(end) {
+				end = finished
+			}
+		}
+	}
+	total := end.Sub(start)
+	if total <= 0 {
+		total = time.Second
+	}
+	x := func(t time.Time) float64 {
+		return math.Round((chartLabelWidth+float64(t.Sub(start))/float64(total)*chartWidth)*10) / 10
+	}
+
+	y := 20
+	for _, result := range run.Results {
+		for _, kasmResult := range result.KasmResults {
+			row := htmlTimelineRow{
+				Label: fmt.Sprintf("%s #%d", result.Username, kasmResult.KasmNumber),
+				Y:     y,
+				Title: fmt.Sprintf("%s #%d %s: request %.1fs, ready %.1fs, exec %.1fs",
+					result.Username, kasmResult.KasmNumber, kasmResult.KasmID,
+					kasmResult.RequestDuration.Seconds(), kasmResult.ReadyDuration.Seconds(), kasmResult.ExecDuration.Seconds()),
+			}
+			if kasmResult.ExecutionError != "" {
+				row.Title += ": " + kasmResult.ExecutionError
+			}
+
+			phaseStart := kasmResult.StartedAt
+			for _, phase := range []struct {
+				duration time.Duration
+				class    string
+			}{
+				{kasmResult.RequestDuration, "request"},
+				{kasmResult.ReadyDuration, "ready"},
+				{kasmResult.ExecDuration, "exec"},
+			} {
+				phaseEnd := phaseStart.Add(phase.duration)
+				row.Segments = append(row.Segments, htmlSegment{
+					X:     x(phaseStart),
+					Width: math.Max(x(phaseEnd)-x(phaseStart), 1),
+					Class: phase.class,
+				})
+				phaseStart = phaseEnd
+			}
+			if kasmResult.ExecutionError != "" {
+				row.Outline = &htmlSegment{
+					X:     x(kasmResult.StartedAt),
+					Width: math.Max(x(phaseStart)-x(kasmResult.StartedAt), 1),
+					Class: "failed",
+				}
+			}
+
+			timeline.Rows = append(timeline.Rows, row)
+			y += timelineRowSize
+		}
+	}
+	timeline.Height = y + 30
+
+	for i := 0; i <= 10; i++ {
+		offset := total * time.Duration(i) / 10
+		timeline.Ticks = append(timeline.Ticks, htmlTick{
+			X:     x(start.Add(offset)),
+			Label: offset.Round(time.Second).String(),
+		})
+	}
+	return timeline
+}
+
+func buildHistogram(startTimes []float64) htmlHistogram {
+	histogram := htmlHistogram{
+		Width:  chartLabelWidth + chartWidth + 20,
+		Height: histogramHeight + 40,
+		Empty:  len(startTimes) == 0,
+	}
+	if histogram.Empty {
+		return histogram
+	}
+
+	maxValue := stats.Percentile(startTimes, 100)
+	binSize := math.Max(math.Ceil(maxValue/histogramBins), 1)
+	counts := make([]int, int(math.Floor(maxValue/binSize))+1)
+	maxCount := 0
+	for _, v := range startTimes {
+		bin := int(v / binSize)
+		counts[bin]++
+		if counts[bin] > maxCount {
+			maxCount = counts[bin]
+		}
+	}
+
+	barWidth := float64(chartWidth) / float64(len(counts))
+	for i, count := range counts {
+		height := float64(count) / float64(maxCount) * histogramHeight
+		histogram.Bars = append(histogram.Bars, htmlBar{
+			X:      chartLabelWidth + float64(i)*barWidth,
+			Y:      10 + histogramHeight - height,
+			Width:  math.Max(barWidth-2, 1),
+			Height: height,
+			Title:  fmt.Sprintf("%.0f-%.0fs: %d sessions", float64(i)*binSize, float64(i+1)*binSize, count),
+		})
+		histogram.Ticks = append(histogram.Ticks, htmlTick{
+			X:     chartLabelWidth + float64(i)*barWidth,
+			Label: fmt.Sprintf("%.0fs", float64(i)*binSize),
+		})
+	}
+	return histogram
+}
+
+func buildFailures(run *models.RunResult) []htmlFailure {
+	byType := make(map[string]*htmlFailure)
+	for _, result := range run.Results {
+		for _, kasmResult := range result.KasmResults {
+			if kasmResult.ExecutionError == "" {
+				continue
+			}
+			failureType := kasmResult.FailureType
+			if failureType == "" {
+				failureType = "unknown"
+			}
+			failure, ok := byType[failureType]
+			if !ok {
+				failure = &htmlFailure{Type: failureType}
+				byType[failureType] = failure
+			}
+			failure.Count++
+			if len(failure.Examples) < 3 {
+				failure.Examples = append(failure.Examples, kasmResult.ExecutionError)
+			}
+		}
+	}
+
+	failures := make([]htmlFailure, 0, len(byType))
+	for _, failure := range byType {
+		failures = append(failures, *failure)
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].Count > failures[j].Count
+	})
+	return failures
+}
+
+// buildAPITimeouts totals the API calls that timed out across users by
+// endpoint, most first
+func buildAPITimeouts(run *models.RunResult) []htmlTimeout {
+	byEndpoint := make(map[string]int)
+	for _, result := range run.Results {
+		for endpoint, count := range result.APITimeouts {
+			byEndpoint[endpoint] += count
+		}
+	}
+
+	timeouts := make([]htmlTimeout, 0, len(byEndpoint))
+	for endpoint, count := range byEndpoint {
+		timeouts = append(timeouts, htmlTimeout{Endpoint: endpoint, Count: count})
+	}
+	sort.Slice(timeouts, func(i, j int) bool {
+		if timeouts[i].Count != timeouts[j].Count {
+			return timeouts[i].Count > timeouts[j].Count
+		}
+		return timeouts[i].Endpoint < timeouts[j].Endpoint
+	})
+	return timeouts
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"formatTime":  func(t time.Time) string { return t.Format("2006-01-02 15:04:05 MST") },
+	"successRate": soakSuccessRate,
+	"since":       func(start, end time.Time) time.Duration { return end.Sub(start).Round(time.Second) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Kasm Stress Test {{.Run.RunID}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #ddd; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 4px 12px 4px 0; vertical-align: top; }
+svg text { font-size: 11px; fill: #444; }
+.request { fill: #8da0cb; }
+.ready { fill: #fc8d62; }
+.exec { fill: #66c2a5; }
+.failed { fill: none; stroke: #d62728; stroke-width: 2; }
+.bar { fill: #8da0cb; }
+.axis { stroke: #bbb; }
+.legend span { display: inline-block; width: 12px; height: 12px; margin: 0 4px 0 12px; vertical-align: middle; }
+.error { color: #d62728; }
+</style>
+</head>
+<body>
+<h1>Kasm Stress Test Report</h1>
+<table>
+<tr><th>Run ID</th><td>{{.Run.RunID}}</td></tr>
+<tr><th>Deployment</th><td>{{.Run.Deployment}}</td></tr>
+{{if .Run.Profile}}<tr><th>Profile</th><td>{{.Run.Profile}}</td></tr>{{end}}
+<tr><th>Started</th><td>{{formatTime .Run.StartedAt}}</td></tr>
+<tr><th>Finished</th><td>{{formatTime .Run.FinishedAt}}</td></tr>
+<tr><th>Duration</th><td>{{.Duration}}</td></tr>
+{{with .Run.Soak}}<tr><th>Soak</th><td>{{.TargetSessions}} sessions across all users for {{.Duration}}, {{.ChurnPerHour}} replaced per hour{{if .WorkloadInterval}}, workload every {{.WorkloadInterval}}{{end}}</td></tr>{{end}}
+{{if .Run.AbortReason}}<tr><th>Aborted</th><td class="error">{{.Run.AbortReason}}</td></tr>{{end}}
+<tr><th>Command</th><td>{{.Run.Command}}</td></tr>
+<tr><th>Users</th><td>{{len .Run.Results}}</td></tr>
+{{with .Run.Teardown}}<tr><th>Teardown</th><td>{{.Destroyed}} destroyed{{if .Failed}}, <span class="error">{{.Failed}} failed</span>{{end}} in {{since .StartedAt .FinishedAt}} by {{.Workers}} workers in {{.Order}} order, {{.Profile}} profile</td></tr>{{end}}
+<tr><th>Sessions</th><td>{{.Sessions}} ({{.Successful}} successful, {{.Failed}} failed{{if .SuccessRate}}, {{.SuccessRate}} success rate{{end}})</td></tr>
+</table>
+
+{{if .Run.Thresholds}}<h2>Thresholds</h2>
+<table>
+<tr><th>Threshold</th><th>Actual</th><th>Result</th></tr>
+{{range .Run.Thresholds}}<tr><td>{{.Threshold}}</td><td>{{.Actual}}</td><td>{{if .Passed}}PASS{{else}}<span class="error">FAIL</span>{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Groups}}<h2>Results by group</h2>
+<table>
+<tr><th>Group</th><th>Users</th><th>Image</th><th>Command</th><th>Start delay</th><th>Sessions</th><th>Successful</th><th>Failed</th><th>Success rate</th><th>Mean time to running</th><th>p95 time to running</th><th>Destroy failures</th></tr>
+{{range .Groups}}<tr><td>{{.Name}}</td><td>{{.Users}}</td>{{with .Settings}}<td>{{.ImageID}}</td><td>{{.Command}}</td><td>{{.StartDelay}}</td>{{else}}<td></td><td></td><td></td>{{end}}<td>{{.Sessions}}</td><td>{{.Successful}}</td><td>{{if .Failed}}<span class="error">{{.Failed}}</span>{{else}}0{{end}}</td><td>{{printf "%.1f%%" .SuccessRate}}</td><td>{{printf "%.1fs" .MeanTimeToRunning.Seconds}}</td><td>{{printf "%.1fs" .P95TimeToRunning.Seconds}}</td><td>{{.DestroyFailures}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Results by user</h2>
+<table>
+<tr>{{if .Groups}}<th>Group</th>{{end}}<th>User</th><th>Sessions</th><th>Successful</th><th>Failed</th><th>Destroy failures</th><th>Average start time</th><th>Total duration</th></tr>
+{{range .Run.Results}}<tr>{{if $.Groups}}<td>{{.Group}}</td>{{end}}<td>{{.Username}}</td><td>{{.TotalKasms}}</td><td>{{.SuccessfulKasms}}</td><td>{{.FailedKasms}}</td><td>{{.DestroyFailures}}</td><td>{{printf "%.1fs" .AverageStartTime.Seconds}}</td><td>{{printf "%.1fs" .TotalDuration.Seconds}}</td></tr>
+{{end}}</table>
+
+<h2>Session timeline</h2>
+<div class="legend"><span style="background:#8da0cb"></span>Requesting<span style="background:#fc8d62"></span>Waiting for ready<span style="background:#66c2a5"></span>Executing commands<span style="border:2px solid #d62728"></span>Failed</div>
+<svg width="{{.Timeline.Width}}" height="{{.Timeline.Height}}" xmlns="http://www.w3.org/2000/svg">
+{{range .Timeline.Ticks}}<line class="axis" x1="{{.X}}" y1="10" x2="{{.X}}" y2="{{$.Timeline.Height}}"></line>
+<text x="{{.X}}" y="{{$.Timeline.Height}}" dy="-4" text-anchor="middle">{{.Label}}</text>
+{{end}}{{range .Timeline.Rows}}<g><title>{{.Title}}</title>
+<text x="0" y="{{.Y}}" dy="12">{{.Label}}</text>
+{{$row := .}}{{range .Segments}}<rect class="{{.Class}}" x="{{.X}}" y="{{$row.Y}}" width="{{.Width}}" height="14"></rect>
+{{end}}{{with .Outline}}<rect class="{{.Class}}" x="{{.X}}" y="{{$row.Y}}" width="{{.Width}}" height="14"></rect>
+{{end}}</g>
+{{end}}</svg>
+
+<h2>Time to running</h2>
+{{if .Histogram.Empty}}<p>No sessions reached the running state.</p>{{else}}
+<table><tr>{{range .Latency}}<th>{{.Name}}</th>{{end}}</tr><tr>{{range .Latency}}<td>{{.Value}}</td>{{end}}</tr></table>
+<svg width="{{.Histogram.Width}}" height="{{.Histogram.Height}}" xmlns="http://www.w3.org/2000/svg">
+{{range .Histogram.Bars}}<rect class="bar" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Title}}</title></rect>
+{{end}}{{range .Histogram.Ticks}}<text x="{{.X}}" y="{{$.Histogram.Height}}" dy="-14">{{.Label}}</text>
+{{end}}</svg>{{end}}
+
+{{if or .Teardown .StillPresent}}<h2>Time to destroyed</h2>
+{{if .Teardown}}<table><tr>{{range .Teardown}}<th>{{.Name}}</th>{{end}}</tr><tr>{{range .Teardown}}<td>{{.Value}}</td>{{end}}</tr></table>{{end}}
+{{if .StillPresent}}<p>Sessions still present at the destroy timeout:</p>
+{{range .StillPresent}}<div class="error">{{.}}</div>
+{{end}}{{end}}{{end}}
+<h2>Failures</h2>
+{{if .Failures}}<table>
+<tr><th>Type</th><th>Count</th><th>Examples</th></tr>
+{{range .Failures}}<tr><td>{{.Type}}</td><td>{{.Count}}</td><td>{{range .Examples}}<div class="error">{{.}}</div>{{end}}</td></tr>
+{{end}}</table>{{else}}<p>No sessions failed.</p>{{end}}
+{{if .APITimeouts}}<h3>API timeouts</h3>
+<table>
+<tr><th>Endpoint</th><th>Calls timed out</th></tr>
+{{range .APITimeouts}}<tr><td>{{.Endpoint}}</td><td class="error">{{.Count}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>Session reconciliation</h2>
+{{with .Run.Reconciliation}}<table>
+<tr><th>On the deployment before the run</th><td>{{len .PreExisting}}</td></tr>
+<tr><th>Vanished before they were destroyed</th><td>{{len .Vanished}}{{range .Vanished}}<div class="error">{{.}}</div>{{end}}</td></tr>
+<tr><th>Still present after they were destroyed</th><td>{{len .Remaining}}{{range .Remaining}}<div class="error">{{.KasmID}} ({{.OperationalStatus}})</div>{{end}}</td></tr>
+{{range .Errors}}<tr><th>Could not list sessions</th><td class="error">{{.}}</td></tr>
+{{end}}</table>
+{{if .PreExisting}}<h3>Sessions on the deployment before the run</h3>
+<table>
+<tr><th>Kasm ID</th><th>User</th><th>Image</th><th>Status</th><th>Server</th><th>Started</th></tr>
+{{range .PreExisting}}<tr><td>{{.KasmID}}</td><td>{{if .User.Username}}{{.User.Username}}{{else}}{{.UserID}}{{end}}</td><td>{{.ImageID}}</td><td>{{.OperationalStatus}}</td><td>{{.ServerID}}</td><td>{{.StartDate}}</td></tr>
+{{end}}</table>{{end}}{{end}}
+
+{{if .Run.Soak}}<h2>Soak time series</h2>
+{{range .Run.Results}}<h3>{{.Username}}</h3>
+{{if .SoakSamples}}<table>
+<tr><th>Time</th><th>Live</th><th>Started</th><th>Failed</th><th>Success rate</th><th>Mean time to running</th><th>p95 time to running</th><th>Destroyed</th><th>Destroy failures</th><th>Workload runs</th><th>Workload failures</th></tr>
+{{range .SoakSamples}}<tr><td>{{formatTime .Time}}</td><td>{{.LiveSessions}}</td><td>{{.Started}}</td><td>{{.Failed}}</td><td>{{with successRate .}}{{.}}%{{end}}</td><td>{{printf "%.1fs" .MeanTimeToRunning.Seconds}}</td><td>{{printf "%.1fs" .P95TimeToRunning.Seconds}}</td><td>{{.Destroyed}}</td><td>{{.DestroyFailures}}</td><td>{{.WorkloadRuns}}</td><td>{{if .WorkloadFailures}}<span class="error">{{.WorkloadFailures}}</span>{{else}}0{{end}}</td></tr>
+{{end}}</table>{{else}}<p>No samples were recorded.</p>{{end}}
+{{end}}{{end}}
+{{with .Run.Teardown}}{{if .Steps}}<h2>Teardown steps ({{.Profile}})</h2>
+<table>
+<tr><th>Time</th><th>Sessions destroyed</th><th>Remaining</th></tr>
+{{range .Steps}}<tr><td>{{formatTime .Time}}</td><td>{{.Sessions}}</td><td>{{.Remaining}}</td></tr>
+{{end}}</table>{{end}}{{end}}
+</body>
+</html>
+`))
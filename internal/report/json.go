@@ -0,0 +1,33 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"kasm-stress-test/internal/models"
+)
+
+// writeJSON writes the full run result as indented JSON, which can be read
+// back with ReadJSON
+func writeJSON(w io.Writer, run *models.RunResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(run)
+}
+
+// ReadJSON loads a run result saved by the json report format
+func ReadJSON(path string) (*models.RunResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open results file: %w", err)
+	}
+	defer f.Close()
+
+	var run models.RunResult
+	if err := json.NewDecoder(f).Decode(&run); err != nil {
+		return nil, fmt.Errorf("could not decode results file %s: %w", path, err)
+	}
+	return &run, nil
+}
@@ -0,0 +1,151 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"kasm-stress-test/internal/models"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// writeJUnit writes a JUnit XML report with one test suite per user and one
+// test case per session, failing with the session's execution error
+func writeJUnit(w io.Writer, run *models.RunResult) error {
+	suites := junitTestSuites{
+		Name: "kasm-stress-test " + run.RunID,
+		Time: seconds(run.FinishedAt.Sub(run.StartedAt)),
+	}
+
+	for _, result := range run.Results {
+		suite := junitTestSuite{
+			Name: result.Username,
+			Time: seconds(result.TotalDuration),
+			Properties: []junitProperty{
+				{Name: "run_id", Value: run.RunID},
+				{Name: "deployment", Value: run.Deployment},
+				{Name: "profile", Value: run.Profile},
+			},
+		}
+		if result.Group != "" {
+			suite.Properties = append(suite.Properties, junitProperty{Name: "group", Value: result.Group})
+		}
+		if !run.StartedAt.IsZero() {
+			suite.Timestamp = run.StartedAt.Format("2006-01-02T15:04:05")
+		}
+
+		for _, kasmResult := range result.KasmResults {
+			testCase := junitTestCase{
+				Name:      fmt.Sprintf("Kasm #%d", kasmResult.KasmNumber),
+				ClassName: "kasm-stress-test." + result.Username,
+				Time:      seconds(kasmResult.RequestDuration + kasmResult.ReadyDuration + kasmResult.ExecDuration),
+			}
+			if kasmResult.ExecutionError != "" {
+				testCase.Failure = &junitFailure{
+					Message: kasmResult.ExecutionError,
+					Body:    fmt.Sprintf("Kasm ID: %s\nImage ID: %s\n%s", kasmResult.KasmID, kasmResult.ImageID, kasmResult.ExecutionError),
+				}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+
+		// A user that failed before any session started still has to show up
+		// as a failure
+		if len(result.KasmResults) == 0 && len(result.Errors) > 0 {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      "setup",
+				ClassName: "kasm-stress-test." + result.Username,
+				Time:      seconds(result.TotalDuration),
+				Failure: &junitFailure{
+					Message: result.Errors[0],
+					Body:    strings.Join(result.Errors, "\n"),
+				},
+			})
+			suite.Failures++
+		}
+
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if len(run.Thresholds) > 0 {
+		suite := junitTestSuite{
+			Name: "thresholds",
+			Time: seconds(0),
+			Properties: []junitProperty{
+				{Name: "run_id", Value: run.RunID},
+				{Name: "deployment", Value: run.Deployment},
+				{Name: "profile", Value: run.Profile},
+			},
+		}
+		for _, threshold := range run.Thresholds {
+			testCase := junitTestCase{
+				Name:      threshold.Threshold,
+				ClassName: "kasm-stress-test.thresholds",
+				Time:      seconds(0),
+			}
+			if !threshold.Passed {
+				testCase.Failure = &junitFailure{
+					Message: fmt.Sprintf("%s (actual %s)", threshold.Threshold, threshold.Actual),
+					Body:    "Actual: " + threshold.Actual,
+				}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
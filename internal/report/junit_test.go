@@ -0,0 +1,80 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"kasm-stress-test/internal/models"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	run := &models.RunResult{
+		RunID: "run-1",
+		Results: []*models.StressTestResult{
+			{
+				Username: "alice",
+				KasmResults: []models.KasmResult{
+					{KasmNumber: 1, KasmID: "k1"},
+					{KasmNumber: 2, KasmID: "k2", ImageID: "img1", ExecutionError: "Kasm <k2> not ready & timed out"},
+				},
+			},
+			{
+				Username: "bob",
+				Errors:   []string{"Failed to get user", "Invalid credentials"},
+			},
+		},
+		Thresholds: []models.ThresholdResult{
+			{Threshold: "success_rate >= 99", Actual: "50.00%"},
+			{Threshold: "failed_sessions <= 5", Actual: "1", Passed: true},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeJUnit(&buf, run); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("writeJUnit() = %s, want an XML header", buf.String())
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("writeJUnit() wrote invalid XML: %v", err)
+	}
+	if suites.Tests != 5 || suites.Failures != 3 || len(suites.Suites) != 3 {
+		t.Fatalf("testsuites = %d tests, %d failures, %d suites, want 5, 3, 3", suites.Tests, suites.Failures, len(suites.Suites))
+	}
+
+	tests := []struct {
+		suite, testCase int
+		name            string
+		message         string
+		body            string
+	}{
+		{suite: 0, testCase: 0, name: "Kasm #1"},
+		{
+			suite: 0, testCase: 1, name: "Kasm #2",
+			message: "Kasm <k2> not ready & timed out",
+			body:    "Kasm ID: k2\nImage ID: img1\nKasm <k2> not ready & timed out",
+		},
+		{suite: 1, testCase: 0, name: "setup", message: "Failed to get user", body: "Failed to get user\nInvalid credentials"},
+		{suite: 2, testCase: 0, name: "success_rate >= 99", message: "success_rate >= 99 (actual 50.00%)", body: "Actual: 50.00%"},
+		{suite: 2, testCase: 1, name: "failed_sessions <= 5"},
+	}
+	for _, tt := range tests {
+		testCase := suites.Suites[tt.suite].Cases[tt.testCase]
+		if testCase.Name != tt.name {
+			t.Errorf("suite %d case %d = %q, want %q", tt.suite, tt.testCase, testCase.Name, tt.name)
+		}
+		if tt.message == "" {
+			if testCase.Failure != nil {
+				t.Errorf("%s failed with %+v, want it to pass", tt.name, testCase.Failure)
+			}
+			continue
+		}
+		if testCase.Failure == nil || testCase.Failure.Message != tt.message || testCase.Failure.Body != tt.body {
+			t.Errorf("%s failure = %+v, want message %q and body %q", tt.name, testCase.Failure, tt.message, tt.body)
+		}
+	}
+}
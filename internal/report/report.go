@@ -0,0 +1,126 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/utils"
+)
+
+// writers maps a report format to the function that renders it
+var writers = map[string]func(w io.Writer, run *models.RunResult) error{
+	"csv":        writeCSV,
+	"html":       writeHTML,
+	"json":       writeJSON,
+	"junit":      writeJUnit,
+	"timeseries": writeTimeseries,
+}
+
+// Spec is a requested report: a format and the path to write it to
+type Spec struct {
+	Format string
+	Path   string
+}
+
+// ParseSpec parses a report flag value in the form "format=path"
+func ParseSpec(value string) (Spec, error) {
+	format, path, ok := strings.Cut(value, "=")
+	if !ok || format == "" || path == "" {
+		return Spec{}, fmt.Errorf("invalid report %q, expected format=path", value)
+	}
+	format = strings.ToLower(format)
+	if _, ok := writers[format]; !ok {
+		return Spec{}, fmt.Errorf("unknown report format %q, expected one of: %s", format, strings.Join(Formats(), ", "))
+	}
+	return Spec{Format: format, Path: path}, nil
+}
+
+// Formats returns the supported report formats
+func Formats() []string {
+	formats := make([]string, 0, len(writers))
+	for format := range writers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Write renders run in the spec's format to the spec's path
+func Write(spec Spec, run *models.RunResult) error {
+	writer, ok := writers[spec.Format]
+	if !ok {
+		return fmt.Errorf("unknown report format %q", spec.Format)
+	}
+
+	// Secrets are redacted from error messages that made it into the
+	// results before rendering, as once escaped they no longer match
+	redactedRun, err := redactRun(run)
+	if err != nil {
+		return fmt.Errorf("could not write %s report: %w", spec.Format, err)
+	}
+	var buf bytes.Buffer
+	if err := writer(&buf, redactedRun); err != nil {
+		return fmt.Errorf("could not write %s report: %w", spec.Format, err)
+	}
+	if err := os.WriteFile(spec.Path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("could not write %s report: %w", spec.Format, err)
+	}
+	return nil
+}
+
+// redactRun returns a copy of run with the registered secrets and API
+// credentials redacted from every string
+func redactRun(run *models.RunResult) (*models.RunResult, error) {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return nil, err
+	}
+	var redactedRun models.RunResult
+	if err := json.Unmarshal(data, &redactedRun); err != nil {
+		return nil, err
+	}
+	redactStrings(reflect.ValueOf(&redactedRun).Elem())
+	return &redactedRun, nil
+}
+
+// redactStrings redacts every string reachable from v through exported
+// fields, pointers, slices and maps
+func redactStrings(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(utils.Redact(v.String()))
+	case reflect.Pointer:
+		if !v.IsNil() {
+			redactStrings(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				redactStrings(v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			redactStrings(v.Index(i))
+		}
+	case reflect.Map:
+		// Map entries can't be changed in place, so they are replaced
+		for _, key := range v.MapKeys() {
+			newKey := reflect.New(key.Type()).Elem()
+			newKey.Set(key)
+			redactStrings(newKey)
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			redactStrings(value)
+			v.SetMapIndex(key, reflect.Value{})
+			v.SetMapIndex(newKey, value)
+		}
+	}
+}
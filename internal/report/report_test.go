@@ -0,0 +1,51 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/utils"
+)
+
+// TestWriteRedacts checks that secrets are redacted from every format, even
+// those that escape the characters a secret contains
+func TestWriteRedacts(t *testing.T) {
+	const secret = `Zq&<"\'Xy>`
+	utils.RegisterSecret(secret)
+
+	message := "Failed to request Kasm: invalid key " + secret
+	run := &models.RunResult{
+		RunID:     "run-1",
+		StartedAt: time.Now(),
+		Results: []*models.StressTestResult{{
+			Username:    "alice",
+			Errors:      []string{message},
+			APITimeouts: map[string]int{"request_kasm " + secret: 1},
+			KasmResults: []models.KasmResult{
+				{KasmNumber: 1, ExecutionError: message, DestroyError: message},
+			},
+		}},
+	}
+	for _, format := range Formats() {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "report")
+			if err := Write(Spec{Format: format, Path: path}, run); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "Zq") || strings.Contains(string(data), "Xy") {
+				t.Errorf("%s report contains the secret:\n%s", format, data)
+			}
+		})
+	}
+	if run.Results[0].Errors[0] != message {
+		t.Errorf("Write() changed the results to %q", run.Results[0].Errors[0])
+	}
+}
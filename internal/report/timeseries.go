@@ -0,0 +1,69 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"kasm-stress-test/internal/models"
+)
+
+var timeseriesHeader = []string{
+	"run_id",
+	"user",
+	"time",
+	"live_sessions",
+	"started",
+	"failed",
+	"success_rate",
+	"mean_time_to_running_seconds",
+	"p95_time_to_running_seconds",
+	"destroyed",
+	"destroy_failures",
+	"workload_runs",
+	"workload_failures",
+}
+
+// writeTimeseries writes one row per soak sample and user
+func writeTimeseries(w io.Writer, run *models.RunResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(timeseriesHeader); err != nil {
+		return err
+	}
+
+	for _, result := range run.Results {
+		for _, sample := range result.SoakSamples {
+			record := []string{
+				run.RunID,
+				result.Username,
+				sample.Time.Format(time.RFC3339),
+				fmt.Sprint(sample.LiveSessions),
+				fmt.Sprint(sample.Started),
+				fmt.Sprint(sample.Failed),
+				soakSuccessRate(sample),
+				seconds(sample.MeanTimeToRunning),
+				seconds(sample.P95TimeToRunning),
+				fmt.Sprint(sample.Destroyed),
+				fmt.Sprint(sample.DestroyFailures),
+				fmt.Sprint(sample.WorkloadRuns),
+				fmt.Sprint(sample.WorkloadFailures),
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// soakSuccessRate is the percentage of sessions started in the sample that
+// reached running, or empty when none were started
+func soakSuccessRate(sample models.SoakSample) string {
+	if sample.Started == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", float64(sample.Started-sample.Failed)/float64(sample.Started)*100)
+}
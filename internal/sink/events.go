@@ -0,0 +1,105 @@
+package sink
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/utils"
+)
+
+var (
+	defaultSink *LineProtocol
+	sinkMutex   sync.RWMutex
+)
+
+// Init opens the default sink that API call and session events are written
+// to. Until Init is called, events are discarded.
+func Init(target string, baseTags Tags, transport http.RoundTripper) error {
+	lp, err := NewLineProtocol(target, baseTags, transport)
+	if err != nil {
+		return err
+	}
+	sinkMutex.Lock()
+	defaultSink = lp
+	sinkMutex.Unlock()
+	return nil
+}
+
+// Close flushes and closes the default sink
+func Close() error {
+	sinkMutex.Lock()
+	defer sinkMutex.Unlock()
+	if defaultSink == nil {
+		return nil
+	}
+	err := defaultSink.Close()
+	defaultSink = nil
+	return err
+}
+
+func write(measurement string, tags Tags, fields Fields, timestamp time.Time) {
+	sinkMutex.RLock()
+	defer sinkMutex.RUnlock()
+	if defaultSink == nil {
+		return
+	}
+	for key, value := range fields {
+		if text, ok := value.(string); ok {
+			fields[key] = utils.Redact(text)
+		}
+	}
+	if err := defaultSink.Write(measurement, tags, fields, timestamp); err != nil {
+		utils.Error("Failed to write %s event: %v", measurement, err)
+	}
+}
+
+// APICall records a single Kasm API call
+func APICall(username, endpoint string, start time.Time, duration time.Duration, err error) {
+	fields := Fields{
+		"duration_ms": duration,
+		"success":     err == nil,
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	write("kasm_api_call", Tags{"user": username, "endpoint": endpoint}, fields, start)
+}
+
+// Session records the outcome of a single Kasm session
+func Session(username, group, imageID string, result models.KasmResult, timestamp time.Time) {
+	fields := Fields{
+		"kasm_id":                  result.KasmID,
+		"start_time_ms":            result.StartTime,
+		"start_time_resolution_ms": result.StartTimeResolution,
+		"success":                  result.ExecutionError == "",
+	}
+	if result.ExecutionError != "" {
+		fields["error"] = result.ExecutionError
+	}
+	tags := Tags{
+		"user":    username,
+		"group":   group,
+		"image":   imageID,
+		"session": strconv.Itoa(result.KasmNumber),
+	}
+	write("kasm_session", tags, fields, timestamp)
+}
+
+// SoakSample records one time-series sample of a soak run
+func SoakSample(username string, sample models.SoakSample) {
+	fields := Fields{
+		"live_sessions":           sample.LiveSessions,
+		"started":                 sample.Started,
+		"failed":                  sample.Failed,
+		"destroyed":               sample.Destroyed,
+		"destroy_failures":        sample.DestroyFailures,
+		"workload_runs":           sample.WorkloadRuns,
+		"workload_failures":       sample.WorkloadFailures,
+		"mean_time_to_running_ms": sample.MeanTimeToRunning,
+		"p95_time_to_running_ms":  sample.P95TimeToRunning,
+	}
+	write("kasm_soak_sample", Tags{"user": username}, fields, sample.Time)
+}
@@ -0,0 +1,297 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tags are the InfluxDB tags attached to a point
+type Tags map[string]string
+
+// Fields are the InfluxDB fields of a point. Values may be string, bool,
+// int, float64 or time.Duration (written as milliseconds).
+type Fields map[string]interface{}
+
+// maxBufferedLines is the number of points buffered before an HTTP sink
+// hands them to its sender without waiting for the next flushInterval
+const maxBufferedLines = 500
+
+// flushInterval is how often an HTTP sink sends the points buffered so far
+const flushInterval = 10 * time.Second
+
+// maxQueuedBatches bounds the batches waiting to be sent. Batches that don't
+// fit, e.g. while the endpoint is down, are dropped rather than held in memory.
+const maxQueuedBatches = 20
+
+// LineProtocol writes points in InfluxDB line protocol to a file or an HTTP
+// write endpoint. HTTP endpoints are written to in the background, so a slow
+// or unreachable endpoint never holds up the API calls recording events.
+type LineProtocol struct {
+	mutex      sync.Mutex
+	file       *os.File
+	url        string
+	token      string
+	httpClient *http.Client
+	buffer     bytes.Buffer
+	buffered   int
+	baseTags   Tags
+
+	batches chan batch
+	done    chan struct{}
+	closed  bool
+	// err is the first error sending points and dropped the number of
+	// points lost, both reported by Close
+	err     error
+	dropped int
+}
+
+// batch is a request body of points waiting to be sent
+type batch struct {
+	body   []byte
+	points int
+}
+
+// NewLineProtocol creates a sink writing to target, which is either an
+// http(s) URL such as http://localhost:8086/write?db=kasm or a file path.
+// baseTags are attached to every point. Points are sent through transport,
+// or http.DefaultTransport if it is nil.
+func NewLineProtocol(target string, baseTags Tags, transport http.RoundTripper) (*LineProtocol, error) {
+	lp := &LineProtocol{baseTags: baseTags}
+
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		lp.url = target
+		lp.token = os.Getenv("KASM_INFLUX_TOKEN")
+		lp.httpClient = &http.Client{Transport: transport, Timeout: 30 * time.Second}
+		lp.batches = make(chan batch, maxQueuedBatches)
+		lp.done = make(chan struct{})
+		go lp.send()
+		return lp, nil
+	}
+
+	file, err := os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open line protocol file: %w", err)
+	}
+	lp.file = file
+	return lp, nil
+}
+
+// Write records a point with the given measurement, tags and fields. Points
+// for an HTTP endpoint are buffered, and failures to send them are reported
+// by Close.
+func (lp *LineProtocol) Write(measurement string, tags Tags, fields Fields, timestamp time.Time) error {
+	line := formatLine(measurement, lp.baseTags, tags, fields, timestamp)
+
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
+	if lp.closed {
+		return fmt.Errorf("line protocol sink is closed")
+	}
+	if lp.file != nil {
+		if _, err := io.WriteString(lp.file, line); err != nil {
+			return fmt.Errorf("error writing line protocol: %w", err)
+		}
+		return nil
+	}
+
+	lp.buffer.WriteString(line)
+	lp.buffered++
+	if lp.buffered >= maxBufferedLines {
+		lp.enqueue()
+	}
+	return nil
+}
+
+// enqueue hands the buffered points to the sender, dropping them if its
+// queue is full. Must be called with lp.mutex held.
+func (lp *LineProtocol) enqueue() {
+	if lp.buffered == 0 {
+		return
+	}
+	b := batch{body: bytes.Clone(lp.buffer.Bytes()), points: lp.buffered}
+	lp.buffer.Reset()
+	lp.buffered = 0
+	select {
+	case lp.batches <- b:
+	default:
+		lp.fail(fmt.Errorf("line protocol endpoint is falling behind, %d batches are waiting", maxQueuedBatches), b.points)
+	}
+}
+
+// fail records points that couldn't be sent. Must be called with lp.mutex
+// held.
+func (lp *LineProtocol) fail(err error, points int) {
+	if lp.err == nil {
+		lp.err = err
+	}
+	lp.dropped += points
+}
+
+// send posts queued batches, and the buffered points every flushInterval,
+// until the queue is closed. A batch that fails is dropped, not retried.
+func (lp *LineProtocol) send() {
+	defer close(lp.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case b, ok := <-lp.batches:
+			if !ok {
+				return
+			}
+			if err := lp.post(b.body); err != nil {
+				lp.mutex.Lock()
+				lp.fail(err, b.points)
+				lp.mutex.Unlock()
+			}
+		case <-ticker.C:
+			lp.mutex.Lock()
+			if !lp.closed {
+				lp.enqueue()
+			}
+			lp.mutex.Unlock()
+		}
+	}
+}
+
+// post sends a request body of points to the HTTP endpoint
+func (lp *LineProtocol) post(body []byte) error {
+	req, err := http.NewRequest("POST", lp.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating line protocol request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if lp.token != "" {
+		req.Header.Set("Authorization", "Token "+lp.token)
+	}
+
+	resp, err := lp.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending line protocol: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("line protocol write failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// Close sends the buffered points, waiting for the sender to finish, and
+// closes the underlying file. It returns the first error sending points.
+func (lp *LineProtocol) Close() error {
+	lp.mutex.Lock()
+	if lp.closed {
+		lp.mutex.Unlock()
+		return nil
+	}
+	lp.closed = true
+	if lp.file != nil {
+		lp.mutex.Unlock()
+		return lp.file.Close()
+	}
+	// The queue may be full, the last points are sent once it has drained
+	last := batch{body: bytes.Clone(lp.buffer.Bytes()), points: lp.buffered}
+	lp.buffer.Reset()
+	lp.buffered = 0
+	close(lp.batches)
+	lp.mutex.Unlock()
+
+	<-lp.done
+	if last.points > 0 {
+		if err := lp.post(last.body); err != nil {
+			lp.fail(err, last.points)
+		}
+	}
+	if lp.err != nil {
+		return fmt.Errorf("%d points were not written: %w", lp.dropped, lp.err)
+	}
+	return nil
+}
+
+// formatLine renders a single point, terminated by a newline
+func formatLine(measurement string, baseTags, tags Tags, fields Fields, timestamp time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(escape(measurement, ", "))
+
+	merged := make(Tags, len(baseTags)+len(tags))
+	for k, v := range baseTags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	for _, k := range sortedKeys(merged) {
+		// Empty tag values are not allowed in line protocol
+		if merged[k] == "" {
+			continue
+		}
+		sb.WriteString("," + escape(k, ",= ") + "=" + escape(merged[k], ",= "))
+	}
+
+	sb.WriteString(" ")
+	fieldKeys := make([]string, 0, len(fields))
+	for k := range fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+	for i, k := range fieldKeys {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(escape(k, ",= ") + "=" + formatField(fields[k]))
+	}
+
+	sb.WriteString(" " + strconv.FormatInt(timestamp.UnixNano(), 10) + "\n")
+	return sb.String()
+}
+
+func formatField(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v) + "i"
+	case int64:
+		return strconv.FormatInt(v, 10) + "i"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Duration:
+		return strconv.FormatFloat(float64(v)/float64(time.Millisecond), 'f', -1, 64)
+	default:
+		return formatField(fmt.Sprint(v))
+	}
+}
+
+// escape backslash-escapes every character in special
+func escape(s, special string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func sortedKeys(tags Tags) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,61 @@
+package sink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatLine(t *testing.T) {
+	timestamp := time.Unix(1700000000, 5)
+	tests := []struct {
+		name        string
+		measurement string
+		baseTags    Tags
+		tags        Tags
+		fields      Fields
+		want        string
+	}{
+		{
+			name:        "tags sorted and merged",
+			measurement: "kasm_session",
+			baseTags:    Tags{"run_id": "r1", "user": "base"},
+			tags:        Tags{"user": "alice", "status": "running"},
+			fields:      Fields{"count": 1},
+			want:        "kasm_session,run_id=r1,status=running,user=alice count=1i 1700000000000000005\n",
+		},
+		{
+			name:        "empty tags left out",
+			measurement: "m",
+			tags:        Tags{"group": "", "user": "bob"},
+			fields:      Fields{"ok": true},
+			want:        "m,user=bob ok=true 1700000000000000005\n",
+		},
+		{
+			name:        "field types",
+			measurement: "m",
+			fields: Fields{
+				"a_int":      3,
+				"b_int64":    int64(-4),
+				"c_float":    1.25,
+				"d_duration": 1500 * time.Microsecond,
+				"e_string":   "ready",
+			},
+			want: `m a_int=3i,b_int64=-4i,c_float=1.25,d_duration=1.5,e_string="ready" 1700000000000000005` + "\n",
+		},
+		{
+			name:        "escaping",
+			measurement: "kasm session,x",
+			tags:        Tags{"user name": "a=b,c d"},
+			fields:      Fields{"error msg": "say \"hi\"\\\nbye"},
+			want:        `kasm\ session\,x,user\ name=a\=b\,c\ d error\ msg="say \"hi\"\\\nbye" 1700000000000000005` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatLine(tt.measurement, tt.baseTags, tt.tags, tt.fields, timestamp)
+			if got != tt.want {
+				t.Errorf("formatLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package slo
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/stats"
+)
+
+// Exit codes returned when thresholds fail. A run failing thresholds in
+// several categories exits with the codes OR'ed together, e.g. 24 when both
+// availability and latency thresholds fail.
+const (
+	ExitAvailability = 8
+	ExitLatency      = 16
+	ExitTeardown     = 32
+)
+
+// metric describes a value that can be measured from a run
+type metric struct {
+	category int
+	duration bool
+	measure  func(run *models.RunResult) float64
+}
+
+var metrics = map[string]metric{
+	"success_rate":         {category: ExitAvailability, measure: successRate},
+	"failed_sessions":      {category: ExitAvailability, measure: failedSessions},
+	"destroy_failures":     {category: ExitTeardown, measure: destroyFailures},
+	"api_timeouts":         {category: ExitAvailability, measure: apiTimeouts},
+	"mean_time_to_running": timeToRunning(-1),
+	"p50_time_to_running":  timeToRunning(50),
+	"p90_time_to_running":  timeToRunning(90),
+	"p95_time_to_running":  timeToRunning(95),
+	"p99_time_to_running":  timeToRunning(99),
+	"max_time_to_running":  timeToRunning(100),
+
+	"mean_time_to_destroyed": timeToDestroyed(-1),
+	"p50_time_to_destroyed":  timeToDestroyed(50),
+	"p90_time_to_destroyed":  timeToDestroyed(90),
+	"p95_time_to_destroyed":  timeToDestroyed(95),
+	"p99_time_to_destroyed":  timeToDestroyed(99),
+	"max_time_to_destroyed":  timeToDestroyed(100),
+}
+
+// Threshold is a single declarative pass/fail condition, e.g.
+// "p95_time_to_running <= 90s"
+type Threshold struct {
+	Metric   string
+	Operator string
+	Value    float64
+	raw      string
+}
+
+// String returns the threshold as it was written
+func (t Threshold) String() string {
+	return t.raw
+}
+
+var thresholdPattern = regexp.MustCompile(`^\s*([a-z0-9_]+)\s*(>=|<=|==|>|<)\s*(\S+)\s*$`)
+
+// Parse parses a threshold of the form "metric operator value". Percentages
+// may carry a trailing %, and time-to-running values may be Go durations
+// such as 90s or plain seconds.
+func Parse(expr string) (Threshold, error) {
+	match := thresholdPattern.FindStringSubmatch(expr)
+	if match == nil {
+		return Threshold{}, fmt.Errorf("invalid threshold %q, expected e.g. 'success_rate >= 99'", expr)
+	}
+
+	name, operator, valueText := match[1], match[2], match[3]
+	m, ok := metrics[name]
+	if !ok {
+		return Threshold{}, fmt.Errorf("unknown threshold metric %q, expected one of: %s", name, strings.Join(Metrics(), ", "))
+	}
+
+	var value float64
+	var err error
+	if d, durationErr := time.ParseDuration(valueText); m.duration && durationErr == nil {
+		value = d.Seconds()
+	} else {
+		value, err = strconv.ParseFloat(strings.TrimSuffix(valueText, "%"), 64)
+		if err != nil {
+			return Threshold{}, fmt.Errorf("invalid value %q in threshold %q", valueText, expr)
+		}
+	}
+
+	return Threshold{Metric: name, Operator: operator, Value: value, raw: strings.TrimSpace(expr)}, nil
+}
+
+// Metrics returns the names of the metrics thresholds can be set on
+func Metrics() []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Evaluate checks every threshold against the run and returns the results
+// along with the exit code the run should end with
+func Evaluate(thresholds []Threshold, run *models.RunResult) ([]models.ThresholdResult, int) {
+	var results []models.ThresholdResult
+	exitCode := 0
+	for _, t := range thresholds {
+		m := metrics[t.Metric]
+		actual := m.measure(run)
+		passed := compare(actual, t.Operator, t.Value)
+		if !passed {
+			exitCode |= m.category
+		}
+		results = append(results, models.ThresholdResult{
+			Threshold: t.String(),
+			Actual:    formatActual(t.Metric, m, actual),
+			Passed:    passed,
+		})
+	}
+	return results, exitCode
+}
+
+// Write prints the evaluated thresholds as a pass/fail table
+func Write(w io.Writer, results []models.ThresholdResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Threshold\tActual\tResult")
+	for _, result := range results {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Threshold, result.Actual, status)
+	}
+	return tw.Flush()
+}
+
+func compare(actual float64, operator string, value float64) bool {
+	// Duration thresholds cannot pass when nothing was measured
+	if math.IsNaN(actual) {
+		return false
+	}
+	switch operator {
+	case ">=":
+		return actual >= value
+	case "<=":
+		return actual <= value
+	case ">":
+		return actual > value
+	case "<":
+		return actual < value
+	default:
+		return actual == value
+	}
+}
+
+func formatActual(name string, m metric, actual float64) string {
+	switch {
+	case math.IsNaN(actual):
+		return "n/a"
+	case name == "success_rate":
+		return fmt.Sprintf("%.2f%%", actual)
+	case m.duration:
+		return fmt.Sprintf("%.1fs", actual)
+	default:
+		return strconv.FormatFloat(actual, 'f', -1, 64)
+	}
+}
+
+func successRate(run *models.RunResult) float64 {
+	sessions, successful := 0, 0
+	for _, result := range run.Results {
+		for _, kasmResult := range result.KasmResults {
+			sessions++
+			if kasmResult.ExecutionError == "" {
+				successful++
+			}
+		}
+	}
+	if sessions == 0 {
+		return 0
+	}
+	return float64(successful) / float64(sessions) * 100
+}
+
+func failedSessions(run *models.RunResult) float64 {
+	failed := 0
+	for _, result := range run.Results {
+		for _, kasmResult := range result.KasmResults {
+			if kasmResult.ExecutionError != "" {
+				failed++
+			}
+		}
+	}
+	return float64(failed)
+}
+
+func destroyFailures(run *models.RunResult) float64 {
+	failures := 0
+	for _, result := range run.Results {
+		failures += result.DestroyFailures
+	}
+	return float64(failures)
+}
+
+func apiTimeouts(run *models.RunResult) float64 {
+	timeouts := 0
+	for _, result := range run.Results {
+		for _, count := range result.APITimeouts {
+			timeouts += count
+		}
+	}
+	return float64(timeouts)
+}
+
+// timeToRunning measures a percentile of the time to running of successful
+// sessions in seconds, or the mean for a negative percentile
+func timeToRunning(percentile float64) metric {
+	return durationMetric(ExitLatency, percentile, func(kasmResult models.KasmResult) (time.Duration, bool) {
+		return kasmResult.StartTime, kasmResult.ExecutionError == ""
+	})
+}
+
+// timeToDestroyed measures a percentile of the time to destroyed of sessions
+// whose destruction was verified in seconds, or the mean for a negative
+// percentile
+func timeToDestroyed(percentile float64) metric {
+	return durationMetric(ExitTeardown, percentile, func(kasmResult models.KasmResult) (time.Duration, bool) {
+		return kasmResult.TimeToDestroyed, kasmResult.TimeToDestroyed > 0
+	})
+}
+
+// durationMetric measures a percentile, or the mean for a negative
+// percentile, of the durations value picks from the sessions of a run
+func durationMetric(category int, percentile float64, value func(models.KasmResult) (time.Duration, bool)) metric {
+	return metric{
+		category: category,
+		duration: true,
+		measure: func(run *models.RunResult) float64 {
+			var durations []float64
+			for _, result := range run.Results {
+				for _, kasmResult := range result.KasmResults {
+					if d, ok := value(kasmResult); ok {
+						durations = append(durations, d.Seconds())
+					}
+				}
+			}
+			if len(durations) == 0 {
+				return math.NaN()
+			}
+			if percentile < 0 {
+				return stats.Mean(durations)
+			}
+			return stats.Percentile(durations, percentile)
+		},
+	}
+}
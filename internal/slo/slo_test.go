@@ -0,0 +1,152 @@
+package slo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"kasm-stress-test/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr     string
+		metric   string
+		operator string
+		value    float64
+		err      string
+	}{
+		{expr: "success_rate >= 99", metric: "success_rate", operator: ">=", value: 99},
+		{expr: "success_rate>=99.5%", metric: "success_rate", operator: ">=", value: 99.5},
+		{expr: "  failed_sessions == 0  ", metric: "failed_sessions", operator: "==", value: 0},
+		{expr: "p95_time_to_running <= 90s", metric: "p95_time_to_running", operator: "<=", value: 90},
+		{expr: "max_time_to_running < 2m", metric: "max_time_to_running", operator: "<", value: 120},
+		{expr: "p99_time_to_destroyed > 45", metric: "p99_time_to_destroyed", operator: ">", value: 45},
+		{expr: "mean_time_to_running <= 1.5", metric: "mean_time_to_running", operator: "<=", value: 1.5},
+		{expr: "success_rate", err: "invalid threshold"},
+		{expr: "success_rate => 99", err: "invalid threshold"},
+		{expr: "succes_rate >= 99", err: `unknown threshold metric "succes_rate"`},
+		{expr: "failed_sessions <= 5s", err: `invalid value "5s"`},
+		{expr: "p95_time_to_running <= fast", err: `invalid value "fast"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			threshold, err := Parse(tt.expr)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Parse(%q) error = %v, want %q", tt.expr, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.expr, err)
+			}
+			if threshold.Metric != tt.metric || threshold.Operator != tt.operator || threshold.Value != tt.value {
+				t.Errorf("Parse(%q) = %s %s %g, want %s %s %g", tt.expr,
+					threshold.Metric, threshold.Operator, threshold.Value, tt.metric, tt.operator, tt.value)
+			}
+			if threshold.String() != strings.TrimSpace(tt.expr) {
+				t.Errorf("String() = %q, want %q", threshold.String(), strings.TrimSpace(tt.expr))
+			}
+		})
+	}
+}
+
+// testRun has four sessions, one of which failed, and a destroy failure
+func testRun() *models.RunResult {
+	return &models.RunResult{
+		Results: []*models.StressTestResult{
+			{
+				KasmResults: []models.KasmResult{
+					{StartTime: 10 * time.Second, TimeToDestroyed: 4 * time.Second},
+					{StartTime: 20 * time.Second, TimeToDestroyed: 6 * time.Second},
+				},
+				APITimeouts: map[string]int{"request_kasm": 1},
+			},
+			{
+				KasmResults: []models.KasmResult{
+					{StartTime: 30 * time.Second},
+					{ExecutionError: "Failed to request Kasm"},
+				},
+				DestroyFailures: 1,
+			},
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name       string
+		thresholds []string
+		actual     []string
+		passed     []bool
+		exitCode   int
+	}{
+		{
+			name:       "all pass",
+			thresholds: []string{"success_rate >= 75", "p50_time_to_running <= 20s", "mean_time_to_destroyed == 5"},
+			actual:     []string{"75.00%", "20.0s", "5.0s"},
+			passed:     []bool{true, true, true},
+		},
+		{
+			name:       "availability",
+			thresholds: []string{"success_rate >= 99", "failed_sessions == 0", "api_timeouts < 1"},
+			actual:     []string{"75.00%", "1", "1"},
+			passed:     []bool{false, false, false},
+			exitCode:   ExitAvailability,
+		},
+		{
+			name:       "latency",
+			thresholds: []string{"max_time_to_running < 30s"},
+			actual:     []string{"30.0s"},
+			passed:     []bool{false},
+			exitCode:   ExitLatency,
+		},
+		{
+			name:       "teardown",
+			thresholds: []string{"destroy_failures == 0", "max_time_to_destroyed <= 5s"},
+			actual:     []string{"1", "6.0s"},
+			passed:     []bool{false, false},
+			exitCode:   ExitTeardown,
+		},
+		{
+			name:       "categories combine",
+			thresholds: []string{"success_rate >= 99", "p95_time_to_running <= 10s", "destroy_failures == 0"},
+			actual:     []string{"75.00%", "29.0s", "1"},
+			passed:     []bool{false, false, false},
+			exitCode:   ExitAvailability | ExitLatency | ExitTeardown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var thresholds []Threshold
+			for _, expr := range tt.thresholds {
+				threshold, err := Parse(expr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				thresholds = append(thresholds, threshold)
+			}
+			results, exitCode := Evaluate(thresholds, testRun())
+			if exitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d", exitCode, tt.exitCode)
+			}
+			for i, result := range results {
+				if result.Threshold != tt.thresholds[i] || result.Actual != tt.actual[i] || result.Passed != tt.passed[i] {
+					t.Errorf("result %d = %+v, want actual %s, passed %v", i, result, tt.actual[i], tt.passed[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateWithoutMeasurements(t *testing.T) {
+	threshold, err := Parse("p95_time_to_destroyed <= 60s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, exitCode := Evaluate([]Threshold{threshold}, &models.RunResult{})
+	if exitCode != ExitTeardown || results[0].Passed || results[0].Actual != "n/a" {
+		t.Errorf("Evaluate() = %+v, %d, want a failed n/a result and exit code %d", results, exitCode, ExitTeardown)
+	}
+}
@@ -0,0 +1,119 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// Percentile returns the p-th percentile (0-100) of values using linear
+// interpolation between the closest ranks. It returns 0 for no values.
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower < 0 {
+		return sorted[0]
+	}
+	if upper >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// Mean returns the arithmetic mean of values, or 0 for no values
+func Mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// normalSF returns the survival function (1 - CDF) of the standard normal
+// distribution at z
+func normalSF(z float64) float64 {
+	return 0.5 * math.Erfc(z/math.Sqrt2)
+}
+
+// ProportionDecrease tests whether the success proportion successes2/n2 is
+// lower than successes1/n1 using a two-proportion z-test. It returns the
+// one-sided p-value; small values mean the second proportion is
+// significantly lower.
+func ProportionDecrease(successes1, n1, successes2, n2 int) float64 {
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	p1 := float64(successes1) / float64(n1)
+	p2 := float64(successes2) / float64(n2)
+	pooled := float64(successes1+successes2) / float64(n1+n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(n1) + 1/float64(n2)))
+	if se == 0 {
+		if p2 < p1 {
+			return 0
+		}
+		return 1
+	}
+	return normalSF((p1 - p2) / se)
+}
+
+// ShiftIncrease tests whether values in b tend to be larger than values in a
+// using the Mann-Whitney U test with a normal approximation and tie
+// correction. It returns the one-sided p-value; small values mean b is
+// significantly larger.
+func ShiftIncrease(a, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	type sample struct {
+		value float64
+		fromB bool
+	}
+	all := make([]sample, 0, n1+n2)
+	for _, v := range a {
+		all = append(all, sample{v, false})
+	}
+	for _, v := range b {
+		all = append(all, sample{v, true})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// Assign average ranks to ties and accumulate the tie correction
+	rankSumB := 0.0
+	tieCorrection := 0.0
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromB {
+				rankSumB += rank
+			}
+		}
+		t := float64(j - i)
+		tieCorrection += t*t*t - t
+		i = j
+	}
+
+	n := float64(n1 + n2)
+	u := rankSumB - float64(n2*(n2+1))/2
+	mean := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * ((n + 1) - tieCorrection/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	// Continuity correction
+	return normalSF((u - mean - 0.5) / math.Sqrt(variance))
+}
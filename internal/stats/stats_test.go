@@ -0,0 +1,104 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{name: "no values", values: nil, p: 50, want: 0},
+		{name: "single value", values: []float64{7}, p: 95, want: 7},
+		{name: "median of odd", values: []float64{3, 1, 2}, p: 50, want: 2},
+		{name: "median of even", values: []float64{4, 1, 3, 2}, p: 50, want: 2.5},
+		{name: "interpolated", values: []float64{10, 20, 30}, p: 95, want: 29},
+		{name: "minimum", values: []float64{5, 1, 9}, p: 0, want: 1},
+		{name: "maximum", values: []float64{5, 1, 9}, p: 100, want: 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Percentile(tt.values, tt.p); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Percentile(%v, %g) = %g, want %g", tt.values, tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentileKeepsValues(t *testing.T) {
+	values := []float64{3, 1, 2}
+	Percentile(values, 50)
+	if values[0] != 3 || values[1] != 1 || values[2] != 2 {
+		t.Errorf("Percentile() reordered its input to %v", values)
+	}
+}
+
+func TestMean(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{nil, 0},
+		{[]float64{4}, 4},
+		{[]float64{1, 2, 3, 4}, 2.5},
+	}
+	for _, tt := range tests {
+		if got := Mean(tt.values); got != tt.want {
+			t.Errorf("Mean(%v) = %g, want %g", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestProportionDecrease(t *testing.T) {
+	tests := []struct {
+		name           string
+		successes1, n1 int
+		successes2, n2 int
+		want           float64
+	}{
+		{name: "dropped", successes1: 90, n1: 100, successes2: 70, n2: 100, want: 0.000203},
+		{name: "rose", successes1: 70, n1: 100, successes2: 90, n2: 100, want: 0.999797},
+		{name: "unchanged", successes1: 50, n1: 100, successes2: 50, n2: 100, want: 0.5},
+		{name: "small drop", successes1: 10, n1: 10, successes2: 8, n2: 10, want: 0.068019},
+		{name: "no sessions in the first", successes1: 0, n1: 0, successes2: 0, n2: 10, want: 1},
+		{name: "no sessions in the second", successes1: 10, n1: 10, successes2: 0, n2: 0, want: 1},
+		{name: "all succeeded", successes1: 10, n1: 10, successes2: 10, n2: 10, want: 1},
+		{name: "all failed", successes1: 0, n1: 10, successes2: 0, n2: 10, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ProportionDecrease(tt.successes1, tt.n1, tt.successes2, tt.n2)
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("ProportionDecrease(%d, %d, %d, %d) = %g, want %g", tt.successes1, tt.n1, tt.successes2, tt.n2, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftIncrease(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{name: "larger", a: []float64{1, 2, 3, 4, 5, 6, 7, 8}, b: []float64{5, 6, 7, 8, 9, 10, 11, 12}, want: 0.006657},
+		{name: "smaller", a: []float64{5, 6, 7, 8, 9, 10, 11, 12}, b: []float64{1, 2, 3, 4, 5, 6, 7, 8}, want: 0.995069},
+		{name: "same values", a: []float64{1, 2, 3, 4, 5, 6, 7, 8}, b: []float64{1, 2, 3, 4, 5, 6, 7, 8}, want: 0.521063},
+		// Without the tie correction the p-value would be 0.0187
+		{name: "ties", a: []float64{1, 1, 1, 2, 2, 2}, b: []float64{2, 2, 2, 3, 3, 3}, want: 0.011962},
+		{name: "all tied", a: []float64{3, 3, 3}, b: []float64{3, 3}, want: 1},
+		{name: "empty first", a: nil, b: []float64{1, 2}, want: 1},
+		{name: "empty second", a: []float64{1, 2}, b: nil, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ShiftIncrease(tt.a, tt.b); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("ShiftIncrease(%v, %v) = %g, want %g", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
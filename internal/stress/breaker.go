@@ -0,0 +1,109 @@
+package stress
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"kasm-stress-test/internal/config"
+	"kasm-stress-test/internal/utils"
+)
+
+// Breaker aborts a run that is clearly failing. It is shared by every Runner
+// in a run; when one of its conditions is met it cancels the run's context,
+// which stops new sessions from being created and interrupts sessions that
+// are still starting. A nil Breaker never trips.
+type Breaker struct {
+	mutex  sync.Mutex
+	config *config.Config
+	cancel context.CancelFunc
+
+	consecutiveFailures int
+	window              []bool
+	stuckRequested      int
+	reason              string
+}
+
+// NewBreaker creates a Breaker using the abort conditions in cfg. cancel is
+// called when the breaker trips.
+func NewBreaker(cfg *config.Config, cancel context.CancelFunc) *Breaker {
+	return &Breaker{
+		config: cfg,
+		cancel: cancel,
+	}
+}
+
+// RecordSession records the outcome of a session
+func (b *Breaker) RecordSession(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if failed {
+		b.consecutiveFailures++
+	} else {
+		b.consecutiveFailures = 0
+	}
+	if limit := b.config.AbortConsecutiveFailures; limit > 0 && b.consecutiveFailures >= limit {
+		b.trip(fmt.Sprintf("%d consecutive sessions failed", b.consecutiveFailures))
+		return
+	}
+
+	size := b.config.AbortErrorRateWindow
+	if b.config.AbortErrorRate <= 0 || size <= 0 {
+		return
+	}
+	b.window = append(b.window, failed)
+	if len(b.window) > size {
+		b.window = b.window[len(b.window)-size:]
+	}
+	if len(b.window) < size {
+		return
+	}
+	failures := 0
+	for _, f := range b.window {
+		if f {
+			failures++
+		}
+	}
+	rate := float64(failures) / float64(size) * 100
+	if rate >= b.config.AbortErrorRate {
+		b.trip(fmt.Sprintf("%.0f%% of the last %d sessions failed", rate, size))
+	}
+}
+
+// RecordStuckRequested records a session that was stuck in the requested state
+func (b *Breaker) RecordStuckRequested() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stuckRequested++
+	if limit := b.config.AbortStuckRequested; limit > 0 && b.stuckRequested >= limit {
+		b.trip(fmt.Sprintf("%d sessions got stuck in the requested state", b.stuckRequested))
+	}
+}
+
+// Tripped reports whether the breaker has tripped and why
+func (b *Breaker) Tripped() (bool, string) {
+	if b == nil {
+		return false, ""
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.reason != "", b.reason
+}
+
+// trip must be called with b.mutex held
+func (b *Breaker) trip(reason string) {
+	if b.reason != "" {
+		return
+	}
+	b.reason = reason
+	utils.Error("Aborting run: %s", reason)
+	b.cancel()
+}
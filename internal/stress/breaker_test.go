@@ -0,0 +1,109 @@
+package stress
+
+import (
+	"testing"
+
+	"kasm-stress-test/internal/config"
+)
+
+func TestBreaker(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		// sessions are recorded in order, true for a failed session and
+		// false for a successful one
+		sessions []bool
+		stuck    int
+		reason   string
+	}{
+		{
+			name:     "consecutive failures",
+			cfg:      config.Config{AbortConsecutiveFailures: 3},
+			sessions: []bool{true, true, true},
+			reason:   "3 consecutive sessions failed",
+		},
+		{
+			name:     "success resets consecutive failures",
+			cfg:      config.Config{AbortConsecutiveFailures: 3},
+			sessions: []bool{true, true, false, true, true},
+		},
+		{
+			name:     "error rate waits for a full window",
+			cfg:      config.Config{AbortErrorRate: 50, AbortErrorRateWindow: 4},
+			sessions: []bool{true, true, true},
+		},
+		{
+			name:     "error rate over a full window",
+			cfg:      config.Config{AbortErrorRate: 50, AbortErrorRateWindow: 4},
+			sessions: []bool{true, false, true, false},
+			reason:   "50% of the last 4 sessions failed",
+		},
+		{
+			name:     "error rate slides",
+			cfg:      config.Config{AbortErrorRate: 75, AbortErrorRateWindow: 4},
+			sessions: []bool{true, false, false, false, true, true, false, true},
+			reason:   "75% of the last 4 sessions failed",
+		},
+		{
+			name:     "error rate below the limit",
+			cfg:      config.Config{AbortErrorRate: 75, AbortErrorRateWindow: 4},
+			sessions: []bool{true, true, false, false, true, false, true, false},
+		},
+		{
+			name:   "stuck requested",
+			cfg:    config.Config{AbortStuckRequested: 2},
+			stuck:  2,
+			reason: "2 sessions got stuck in the requested state",
+		},
+		{
+			name:  "stuck requested below the limit",
+			cfg:   config.Config{AbortStuckRequested: 2},
+			stuck: 1,
+		},
+		{
+			name:     "first reason kept",
+			cfg:      config.Config{AbortConsecutiveFailures: 2, AbortErrorRate: 50, AbortErrorRateWindow: 2, AbortStuckRequested: 1},
+			sessions: []bool{true, true, true},
+			stuck:    1,
+			reason:   "2 consecutive sessions failed",
+		},
+		{
+			name:     "disabled",
+			sessions: []bool{true, true, true, true},
+			stuck:    3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cancels := 0
+			b := NewBreaker(&tt.cfg, func() { cancels++ })
+			for _, failed := range tt.sessions {
+				b.RecordSession(failed)
+			}
+			for i := 0; i < tt.stuck; i++ {
+				b.RecordStuckRequested()
+			}
+
+			tripped, reason := b.Tripped()
+			if tripped != (tt.reason != "") || reason != tt.reason {
+				t.Errorf("Tripped() = %v, %q, want %q", tripped, reason, tt.reason)
+			}
+			wantCancels := 0
+			if tt.reason != "" {
+				wantCancels = 1
+			}
+			if cancels != wantCancels {
+				t.Errorf("cancelled %d times, want %d", cancels, wantCancels)
+			}
+		})
+	}
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *Breaker
+	b.RecordSession(true)
+	b.RecordStuckRequested()
+	if tripped, reason := b.Tripped(); tripped || reason != "" {
+		t.Errorf("Tripped() = %v, %q, want a nil breaker never to trip", tripped, reason)
+	}
+}
@@ -0,0 +1,202 @@
+package stress
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"kasm-stress-test/internal/api"
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/utils"
+)
+
+// liveSession is a running session tracked until it is destroyed
+type liveSession struct {
+	number int
+	// addedAt is when the session started being tracked
+	addedAt   time.Time
+	expiresAt time.Time
+}
+
+// goneSession is a tracked session that disappeared before it was destroyed
+type goneSession struct {
+	failureType string
+	message     string
+}
+
+// liveSessions tracks a runner's running sessions from the time they are
+// running until they are destroyed. They are kept alive and reconciled
+// against the deployment from other goroutines.
+type liveSessions struct {
+	mutex    sync.Mutex
+	sessions map[string]*liveSession
+	gone     map[string]goneSession
+}
+
+func newLiveSessions() *liveSessions {
+	return &liveSessions{
+		sessions: make(map[string]*liveSession),
+		gone:     make(map[string]goneSession),
+	}
+}
+
+func (l *liveSessions) add(kasmID string, number int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sessions[kasmID] = &liveSession{number: number, addedAt: time.Now()}
+}
+
+func (l *liveSessions) remove(kasmID string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.sessions, kasmID)
+}
+
+// isGone reports whether a tracked session was found to be gone
+func (l *liveSessions) isGone(kasmID string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, ok := l.gone[kasmID]
+	return ok
+}
+
+// markGone records that a tracked session disappeared, logging it with the
+// fields of log. It reports false if the session is no longer tracked, e.g.
+// because it was destroyed meanwhile. Must be called with l.mutex held.
+func (l *liveSessions) markGone(log utils.Logger, kasmID, failureType, message string) bool {
+	session, ok := l.sessions[kasmID]
+	if !ok {
+		return false
+	}
+	log.With("session_number", session.number, "kasm_id", kasmID).Error("Kasm %d (%s) %s", session.number, kasmID, message)
+	l.gone[kasmID] = goneSession{failureType: failureType, message: message}
+	delete(l.sessions, kasmID)
+	return true
+}
+
+// startKeepalive starts keeping the runner's running sessions alive, if
+// enabled in the config
+func (r *Runner) startKeepalive(ctx context.Context) {
+	if !r.config.Keepalive || r.keepaliveStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	r.keepaliveStop, r.keepaliveDone = stop, done
+
+	interval := time.Duration(r.config.KeepaliveIntervalSeconds) * time.Second
+	margin := time.Duration(r.config.KeepaliveMarginSeconds) * time.Second
+	// Sessions are kept alive until they are destroyed, even after the run
+	// has been aborted
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.keepSessionsAlive(ctx, margin)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopKeepalive stops the keepalive loop
+func (r *Runner) stopKeepalive() {
+	if r.keepaliveStop == nil {
+		return
+	}
+	close(r.keepaliveStop)
+	<-r.keepaliveDone
+	r.keepaliveStop, r.keepaliveDone = nil, nil
+}
+
+// keepSessionsAlive sends a keepalive to every session that expires within
+// margin, or whose expiration is not yet known, and refreshes its expiration
+func (r *Runner) keepSessionsAlive(ctx context.Context, margin time.Duration) {
+	l := r.live
+	l.mutex.Lock()
+	due := make(map[string]liveSession)
+	for kasmID, session := range l.sessions {
+		if session.expiresAt.IsZero() || time.Until(session.expiresAt) < margin {
+			due[kasmID] = *session
+		}
+	}
+	l.mutex.Unlock()
+
+	for kasmID, session := range due {
+		log := r.log.With("session_number", session.number, "kasm_id", kasmID)
+		ctx := utils.ContextWithLogger(ctx, log)
+		if err := r.client.Keepalive(ctx, kasmID); err != nil {
+			log.Error("Failed to keep Kasm %s alive: %v", kasmID, err)
+		}
+
+		status, err := r.client.GetKasmStatus(ctx, kasmID, r.UserID)
+		gone := api.KasmGone(status, err)
+		if err != nil && !gone {
+			log.Error("Failed to refresh expiration of Kasm %s: %v", kasmID, err)
+			continue
+		}
+
+		l.mutex.Lock()
+		if gone {
+			// The session is gone. It expired if its expiration had passed,
+			// otherwise it was removed by something else.
+			reason := fmt.Sprint(err)
+			if err == nil {
+				reason = status.ErrorMessage
+			}
+			if !session.expiresAt.IsZero() && time.Now().After(session.expiresAt) {
+				l.markGone(r.log, kasmID, models.FailureExpired, fmt.Sprintf("expired at %s before it was destroyed", session.expiresAt.Format(time.RFC3339)))
+			} else {
+				l.markGone(r.log, kasmID, models.FailureVanished, fmt.Sprintf("vanished before it was destroyed: %s", reason))
+			}
+		} else if expiresAt, err := api.ParseKasmTime(status.Kasm.ExpirationDate); err == nil {
+			if tracked, ok := l.sessions[kasmID]; ok {
+				tracked.expiresAt = expiresAt
+				log.Info("Kasm %s kept alive until %s", kasmID, expiresAt.Format(time.RFC3339))
+			}
+		}
+		l.mutex.Unlock()
+	}
+}
+
+// recordGoneSessions marks the results of sessions that disappeared before
+// they were destroyed as failed. They aren't destroyed, as there is nothing
+// left to destroy.
+func (r *Runner) recordGoneSessions() {
+	if r.result == nil {
+		return
+	}
+	l := r.live
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for kasmID, gone := range l.gone {
+		for i := range r.result.KasmResults {
+			kasmResult := &r.result.KasmResults[i]
+			if kasmResult.KasmID != kasmID || kasmResult.FailureType == gone.failureType {
+				continue
+			}
+			if kasmResult.ExecutionError == "" {
+				r.result.SuccessfulKasms--
+				r.result.FailedKasms++
+			}
+			kasmResult.ExecutionError = "Kasm " + gone.message
+			kasmResult.FailureType = gone.failureType
+			r.result.Errors = append(r.result.Errors, fmt.Sprintf("Kasm %d: %s", kasmResult.KasmNumber, kasmResult.ExecutionError))
+		}
+	}
+
+	remaining := r.kasmsToDestroy[:0]
+	for _, kasmID := range r.kasmsToDestroy {
+		if _, ok := l.gone[kasmID]; !ok {
+			remaining = append(remaining, kasmID)
+		}
+	}
+	r.kasmsToDestroy = remaining
+}
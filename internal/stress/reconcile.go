@@ -0,0 +1,81 @@
+package stress
+
+import (
+	"time"
+
+	"kasm-stress-test/internal/models"
+)
+
+// deletingStatuses are the operational statuses of sessions that are being
+// torn down and will disappear on their own
+var deletingStatuses = map[string]bool{
+	"deleting":   true,
+	"destroying": true,
+	"stopping":   true,
+}
+
+// KasmIDs returns the set of IDs of kasms
+func KasmIDs(kasms []models.KasmInfo) map[string]bool {
+	ids := make(map[string]bool, len(kasms))
+	for _, kasm := range kasms {
+		ids[kasm.KasmID] = true
+	}
+	return ids
+}
+
+// Remaining returns the sessions in kasms that were created by the run, as
+// recorded in results, and are not being deleted
+func Remaining(kasms []models.KasmInfo, results []*models.StressTestResult) []models.KasmInfo {
+	created := make(map[string]bool)
+	for _, result := range results {
+		for _, kasmResult := range result.KasmResults {
+			if kasmResult.KasmID != "" {
+				created[kasmResult.KasmID] = true
+			}
+		}
+	}
+
+	var remaining []models.KasmInfo
+	for _, kasm := range kasms {
+		if created[kasm.KasmID] && !deletingStatuses[kasm.OperationalStatus] {
+			remaining = append(remaining, kasm)
+		}
+	}
+	return remaining
+}
+
+// Vanished returns the IDs of the sessions in results that disappeared from
+// the deployment before they were destroyed
+func Vanished(results []*models.StressTestResult) []string {
+	var vanished []string
+	for _, result := range results {
+		for _, kasmResult := range result.KasmResults {
+			if kasmResult.FailureType == models.FailureVanished {
+				vanished = append(vanished, kasmResult.KasmID)
+			}
+		}
+	}
+	return vanished
+}
+
+// Reconcile checks the runner's running sessions against present, the IDs
+// of every session on the deployment listed at listedAt, and records those
+// that are missing as vanished. Sessions tracked since listedAt can't be in
+// the list and are left for the next one. It returns the IDs of the sessions
+// that vanished.
+func (r *Runner) Reconcile(present map[string]bool, listedAt time.Time) []string {
+	l := r.live
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var vanished []string
+	for kasmID, session := range l.sessions {
+		if !session.addedAt.Before(listedAt) {
+			continue
+		}
+		if !present[kasmID] && l.markGone(r.log, kasmID, models.FailureVanished, "vanished from the deployment before it was destroyed") {
+			vanished = append(vanished, kasmID)
+		}
+	}
+	return vanished
+}
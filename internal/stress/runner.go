@@ -1,6 +1,8 @@
 package stress
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -8,7 +10,10 @@ import (
 
 	"kasm-stress-test/internal/api"
 	"kasm-stress-test/internal/config"
+	"kasm-stress-test/internal/metrics"
 	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/sink"
+	"kasm-stress-test/internal/tracing"
 	"kasm-stress-test/internal/utils"
 )
 
@@ -16,54 +21,117 @@ type Runner struct {
 	client         *api.Client
 	config         *config.Config
 	username       string
+	group          string
+	imageID        string
+	startDelay     time.Duration
 	sessionNum     utils.IntFlag
 	command        string
+	log            utils.Logger
 	kasmsToDestroy []string
+	result         *models.StressTestResult
+	// Breaker, if set, aborts the run when too many sessions fail
+	Breaker        *Breaker
+	sessionSpans   map[string]*tracing.Span
+	live           *liveSessions
+	keepaliveStop  chan struct{}
+	keepaliveDone  chan struct{}
 	UserID         string
 	wg             sync.WaitGroup
 	statusCallback func(sessionNumber int, status string, duration time.Duration)
 }
 
-func NewRunner(cfg *config.Config, username string, sessionNum utils.IntFlag, command string) *Runner {
+// NewRunner creates the runner of one user of a group, which starts the
+// group's sessions with its image and workload. The group's settings must
+// have been defaulted, see config.Config.RunGroups.
+func NewRunner(cfg *config.Config, group config.Group, username string) *Runner {
+	client := api.NewClient(cfg)
+	client.Username = username
+	log := utils.With("user", username)
+	if group.Name != "" {
+		log = log.With("group", group.Name)
+	}
 	return &Runner{
-		client:         api.NewClient(cfg),
+		client:         client,
 		config:         cfg,
 		username:       username,
-		sessionNum:     sessionNum,
-		command:        command,
+		group:          group.Name,
+		imageID:        group.ImageID,
+		startDelay:     group.StartDelay(),
+		sessionNum:     utils.IntFlag{Value: group.Sessions},
+		command:        group.Command,
+		log:            log,
+		sessionSpans:   make(map[string]*tracing.Span),
+		live:           newLiveSessions(),
 		statusCallback: func(sessionNumber int, status string, duration time.Duration) {},
 	}
 }
 
-func (r *Runner) Run(callback func(sessionNumber int, status string, duration time.Duration)) *models.StressTestResult {
+func (r *Runner) Run(ctx context.Context, callback func(sessionNumber int, status string, duration time.Duration)) *models.StressTestResult {
 	r.statusCallback = callback
 	r.wg.Add(1)
 	defer r.wg.Done()
 	startTime := time.Now()
 	result := &models.StressTestResult{
 		Username:   r.username,
+		Group:      r.group,
 		TotalKasms: r.sessionNum.Value,
 	}
+	r.result = result
+	ctx = utils.ContextWithLogger(ctx, r.log)
 
-	user, err := r.client.GetUserInfo(r.username)
+	if err := r.waitToStart(ctx); err != nil {
+		result.Aborted = true
+		return result
+	}
+
+	user, err := r.client.GetUserInfo(ctx, r.username)
 	if err != nil {
 		result.Errors = append(result.Errors, fmt.Sprintf("Failed to get user info: %v", err))
 		return result
 	}
 	r.UserID = user.UserID
+	r.startKeepalive(ctx)
 
 	for i := 0; i < r.sessionNum.Value; i++ {
-		kasmResult := r.createAndTestKasm(i, user.UserID)
+		if ctx.Err() != nil {
+			// The run was aborted, don't create any more sessions
+			result.Aborted = true
+			for j := i; j < r.sessionNum.Value; j++ {
+				r.statusCallback(j, "Skipped", 0)
+			}
+			break
+		}
+
+		sessionStart := time.Now()
+		// Each session is its own trace
+		sessionCtx, span := tracing.Start(ctx, "kasm_session", tracing.KindInternal,
+			tracing.String("user", r.username),
+			tracing.Int("session_number", i+1))
+		sessionCtx = utils.ContextWithLogger(sessionCtx, r.log.With("session_number", i+1))
+		kasmResult := r.createAndTestKasm(sessionCtx, i, i+1, user.UserID)
+		if kasmResult.ExecutionError != "" {
+			span.RecordError(errors.New(kasmResult.ExecutionError))
+		}
+		if kasmResult.KasmID != "" {
+			span.SetAttributes(tracing.String("kasm_id", kasmResult.KasmID))
+			r.sessionSpans[kasmResult.KasmID] = span
+		}
+		span.End()
 		result.KasmResults = append(result.KasmResults, kasmResult)
+		sink.Session(r.username, r.group, r.imageID, kasmResult, sessionStart)
+
+		// Failed sessions may still have created a Kasm that needs cleaning up
+		if kasmResult.KasmID != "" {
+			r.kasmsToDestroy = append(r.kasmsToDestroy, kasmResult.KasmID)
+		}
+		r.Breaker.RecordSession(kasmResult.ExecutionError != "")
 
 		if kasmResult.ExecutionError == "" {
 			result.SuccessfulKasms++
-			if kasmResult.KasmID != "" {
-				r.kasmsToDestroy = append(r.kasmsToDestroy, kasmResult.KasmID)
-			}
 		} else {
 			result.FailedKasms++
 			result.Errors = append(result.Errors, fmt.Sprintf("Kasm %d: %s", i, kasmResult.ExecutionError))
+			r.statusCallback(i, "Failed", time.Since(sessionStart))
 		}
 		result.AverageStartTime += kasmResult.StartTime
 	}
@@ -76,92 +144,190 @@ func (r *Runner) Run(callback func(sessionNumber int, status string, duration ti
 	return result
 }
 
-func (r *Runner) createAndTestKasm(numKasms int, userID string) models.KasmResult {
+// waitToStart holds back the runner's first session by the group's start
+// delay. If the run is aborted meanwhile every session is reported skipped.
+func (r *Runner) waitToStart(ctx context.Context) error {
+	if r.startDelay <= 0 {
+		return nil
+	}
+	r.log.Info("Delaying the sessions of %s by %s", r.username, r.startDelay)
+	for i := 0; i < r.sessionNum.Value; i++ {
+		r.statusCallback(i, "Waiting to start", 0)
+	}
+	if err := sleepUntil(ctx, time.Now().Add(r.startDelay)); err != nil {
+		for i := 0; i < r.sessionNum.Value; i++ {
+			r.statusCallback(i, "Skipped", 0)
+		}
+		return err
+	}
+	return nil
+}
+
+// createAndTestKasm starts a session and runs the workload on it. slot is the
+// position reported to the status callback and number the session number
+// recorded in the result.
+func (r *Runner) createAndTestKasm(ctx context.Context, slot, number int, userID string) models.KasmResult {
 	result := models.KasmResult{
-		KasmNumber: numKasms + 1,
+		KasmNumber: number,
+		ImageID:    r.imageID,
 	}
 
-	// utils.Console("Starting session %d for user %s\n", numKasms+1, r.username)
-	utils.Info("Starting test for Kasm %d", numKasms+1)
+	log := utils.LoggerFromContext(ctx)
+	// utils.Console("Starting session %d for user %s\n", number, r.username)
+	log.Info("Starting test for Kasm %d", number)
 	startTime := time.Now()
+	result.StartedAt = startTime
 
 	// Step 1: Request Kasm
-	utils.Info("Step 1: Requesting Kasm for user %s", r.username)
-	kasm, err := r.client.RequestKasm(userID, r.config.DefaultImageID)
-	r.statusCallback(numKasms, "Requesting Kasm", time.Since(startTime))
+	log.Info("Step 1: Requesting Kasm for user %s", r.username)
+	stepCtx, span := tracing.Start(ctx, "request_kasm", tracing.KindInternal)
+	kasm, err := r.client.RequestKasm(stepCtx, userID, r.imageID)
+	span.RecordError(err)
+	span.End()
+	result.RequestDuration = time.Since(startTime)
+	r.statusCallback(slot, "Requesting Kasm", time.Since(startTime))
 	if err != nil {
-		utils.Error("Failed to request Kasm for user %s: %v", r.username, err)
+		log.Error("Failed to request Kasm for user %s: %v", r.username, err)
 		result.ExecutionError = fmt.Sprintf("Failed to request Kasm: %v", err)
+		result.FailureType = models.FailureRequest
+		result.TimedOutEndpoint = api.TimedOutEndpoint(err)
 		return result
 	}
 
 	if kasm == nil || kasm.KasmID == "" {
 		result.ExecutionError = "Received empty Kasm ID from API"
+		result.FailureType = models.FailureRequest
 		return result
 	}
 
 	result.KasmID = kasm.KasmID
+	// Everything logged about the Kasm from here on carries its ID
+	log = log.With("kasm_id", kasm.KasmID)
+	kasmCtx := utils.ContextWithLogger(ctx, log)
 
 	// Step 2: Wait for Kasm to be ready
-	utils.Info("Step 2: Waiting for Kasm %s to be ready", kasm.KasmID)
-	err = r.client.WaitForKasmReady(kasm.KasmID, userID, 10*time.Minute)
-	r.statusCallback(numKasms, "Waiting for Kasm", time.Since(startTime))
+	log.Info("Step 2: Waiting for Kasm %s to be ready", kasm.KasmID)
+	stepCtx, span = tracing.Start(kasmCtx, "wait_for_ready", tracing.KindInternal, tracing.String("kasm_id", kasm.KasmID))
+	status, resolution, err := r.client.WaitForKasmReady(stepCtx, kasm.KasmID, userID, api.NewPollPolicy(r.config))
+	span.RecordError(err)
+	span.End()
+	result.ReadyDuration = time.Since(startTime) - result.RequestDuration
+	r.statusCallback(slot, "Waiting for Kasm", time.Since(startTime))
 	if err != nil {
 		if strings.Contains(err.Error(), "stuck in 'requested' state for too long") {
-			utils.Error("Kasm %s stuck in 'requested' state. Attempting to destroy and recreate.", kasm.KasmID)
-			r.client.DestroyKasm(kasm.KasmID, userID)
+			log.Error("Kasm %s stuck in 'requested' state. Attempting to destroy and recreate.", kasm.KasmID)
+			r.Breaker.RecordStuckRequested()
+			// Destroy even if the run is being aborted, the Kasm would leak otherwise
+			r.client.DestroyKasm(context.WithoutCancel(kasmCtx), kasm.KasmID, userID)
+			metrics.Retries.Inc("request_kasm")
 			utils.Console("Giving the new agent a chance to catch up. Sleeiping for 5 minutes")
-			time.Sleep(5 * time.Minute)
-			return r.createAndTestKasm(numKasms, userID) // Recursive call to retry
+			select {
+			case <-time.After(5 * time.Minute):
+			case <-ctx.Done():
+				result.KasmID = ""
+				result.ExecutionError = fmt.Sprintf("Run aborted while retrying stuck Kasm: %v", ctx.Err())
+				result.FailureType = models.FailureNotReady
+				return result
+			}
+			return r.createAndTestKasm(ctx, slot, number, userID) // Recursive call to retry
 		}
-		utils.Error("Failed waiting for Kasm %s to be ready: %v", kasm.KasmID, err)
+		log.Error("Failed waiting for Kasm %s to be ready: %v", kasm.KasmID, err)
 		result.ExecutionError = fmt.Sprintf("Failed waiting for Kasm to be ready: %v", err)
+		result.FailureType = models.FailureNotReady
+		result.TimedOutEndpoint = api.TimedOutEndpoint(err)
+		if strings.Contains(err.Error(), "timeout waiting") {
+			result.FailureType = models.FailureReadyTimeout
+		}
 		return result
 	}
 
 	result.StartTime = time.Since(startTime)
+	result.StartTimeResolution = resolution
+	result.ServerID = status.Kasm.ServerID
+	r.live.add(kasm.KasmID, number)
+	metrics.TimeToRunning.Observe(result.StartTime.Seconds(), r.username)
 
 	// Step 3: Execute command
-	utils.Info("Step 3: Executing command on Kasm %s", kasm.KasmID)
+	log.Info("Step 3: Executing command on Kasm %s", kasm.KasmID)
+	execStart := time.Now()
 
 	if r.command == "all" {
 		// Execute CPU test
-		err = r.client.ExecCommand(kasm.KasmID, userID, r.getCPUCommand())
-		r.statusCallback(numKasms, "Executing command", time.Since(startTime))
+		err = r.execCommand(kasmCtx, kasm.KasmID, userID, r.getCPUCommand())
+		r.statusCallback(slot, "Executing command", time.Since(startTime))
 		if err != nil {
-			utils.Error("Failed to execute CPU command on Kasm %s: %v", kasm.KasmID, err)
+			log.Error("Failed to execute CPU command on Kasm %s: %v", kasm.KasmID, err)
 			result.ExecutionError = fmt.Sprintf("Failed to execute CPU command: %v", err)
+			result.FailureType = models.FailureExec
+			if endpoint := api.TimedOutEndpoint(err); endpoint != "" {
+				result.TimedOutEndpoint = endpoint
+			}
 		} else {
-			utils.Info("CPU command executed on Kasm %s", kasm.KasmID)
+			log.Info("CPU command executed on Kasm %s", kasm.KasmID)
 		}
 
 		// Execute Network test
-		err = r.client.ExecCommand(kasm.KasmID, userID, r.getNetworkCommand())
-		r.statusCallback(numKasms, "Executing command", time.Since(startTime))
+		err = r.execCommand(kasmCtx, kasm.KasmID, userID, r.getNetworkCommand())
+		r.statusCallback(slot, "Executing command", time.Since(startTime))
 		if err != nil {
-			utils.Error("Failed to execute Network command on Kasm %s: %v", kasm.KasmID, err)
+			log.Error("Failed to execute Network command on Kasm %s: %v", kasm.KasmID, err)
 			result.ExecutionError += fmt.Sprintf(" Failed to execute Network command: %v", err)
+			result.FailureType = models.FailureExec
+			if endpoint := api.TimedOutEndpoint(err); endpoint != "" {
+				result.TimedOutEndpoint = endpoint
+			}
 		} else {
-			utils.Info("Network command executed on Kasm %s", kasm.KasmID)
+			log.Info("Network command executed on Kasm %s", kasm.KasmID)
 		}
 	} else {
 		// Execute single command for other cases
 		command := r.getCommandToExecute()
-		err = r.client.ExecCommand(kasm.KasmID, userID, command)
-		r.statusCallback(numKasms, "Executing command", time.Since(startTime))
+		err = r.execCommand(kasmCtx, kasm.KasmID, userID, command)
+		r.statusCallback(slot, "Executing command", time.Since(startTime))
 		if err != nil {
-			utils.Error("Failed to execute command on Kasm %s: %v", kasm.KasmID, err)
+			log.Error("Failed to execute command on Kasm %s: %v", kasm.KasmID, err)
 			result.ExecutionError = fmt.Sprintf("Failed to execute command: %v", err)
+			result.FailureType = models.FailureExec
+			if endpoint := api.TimedOutEndpoint(err); endpoint != "" {
+				result.TimedOutEndpoint = endpoint
+			}
 		} else {
-			utils.Info("Command executed on Kasm %s", kasm.KasmID)
+			log.Info("Command executed on Kasm %s", kasm.KasmID)
 		}
 	}
 
-	utils.Info("Completed test for Kasm %d", numKasms+1)
-	r.statusCallback(numKasms, "Completed", time.Since(startTime))
+	result.ExecDuration = time.Since(execStart)
+
+	log.Info("Completed test for Kasm %d", number)
+	r.statusCallback(slot, "Completed", time.Since(startTime))
 	return result
 }
 
+// execCommand runs command on a Kasm inside its own span
+func (r *Runner) execCommand(ctx context.Context, kasmID, userID, command string) error {
+	ctx, span := tracing.Start(ctx, "exec_command", tracing.KindInternal,
+		tracing.String("kasm_id", kasmID),
+		tracing.String("command", command))
+	defer span.End()
+	err := r.client.ExecCommand(ctx, kasmID, userID, command)
+	span.RecordError(err)
+	return err
+}
+
+// runWorkload runs the workload commands on a session that is already running
+func (r *Runner) runWorkload(ctx context.Context, kasmID, userID string) error {
+	commands := []string{r.getCommandToExecute()}
+	if r.command == "all" {
+		commands = []string{r.getCPUCommand(), r.getNetworkCommand()}
+	}
+	for _, command := range commands {
+		if err := r.execCommand(ctx, kasmID, userID, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *Runner) getCPUCommand() string {
 	return "dd if=/dev/zero of=/dev/null bs=1M count=1000"
 }
@@ -181,31 +347,24 @@ func (r *Runner) getCommandToExecute() string {
 	}
 }
 
-func (r *Runner) DestroyAllSessions() error {
-	var errors []string
-	for _, kasmID := range r.kasmsToDestroy {
-		if err := r.client.DestroyKasm(kasmID, r.UserID); err != nil {
-			utils.Info("Kasm ID: %s, User ID: %v", kasmID, r.UserID)
-			utils.Error("Failed to destroy Kasm %s: %v", kasmID, err)
-			errors = append(errors, fmt.Sprintf("Failed to destroy Kasm %s: %v", kasmID, err))
-		}
-	}
-	if len(errors) > 0 {
-		return fmt.Errorf("%s", strings.Join(errors, "; "))
-	}
-	return nil
+// DestroyAllSessions destroys the runner's sessions, see Teardown
+func (r *Runner) DestroyAllSessions(ctx context.Context) error {
+	_, err := Teardown(ctx, []*Runner{r}, NewTeardownOptions(r.config))
+	return err
 }
 
-func (r *Runner) GetAutoscalingStatus() (*models.AutoscalingStatus, error) {
-	// Implement this method if your API provides autoscaling information
-	// For now, we'll return a placeholder
-	return &models.AutoscalingStatus{
-		CurrentNodes: 1,
-		DesiredNodes: 1,
-		PendingNodes: 0,
-		MaxNodes:     10,
-		CurrentLoad:  0.5,
-	}, nil
+// destroyKasm destroys a Kasm, recording the span in the trace of the session
+// that created it
+func (r *Runner) destroyKasm(ctx context.Context, kasmID string) error {
+	if sessionSpan, ok := r.sessionSpans[kasmID]; ok {
+		ctx = tracing.ContextWithSpan(ctx, sessionSpan)
+	}
+	ctx = utils.ContextWithLogger(ctx, r.log.With("kasm_id", kasmID))
+	ctx, span := tracing.Start(ctx, "destroy_kasm", tracing.KindInternal, tracing.String("kasm_id", kasmID))
+	defer span.End()
+	err := r.client.DestroyKasm(ctx, kasmID, r.UserID)
+	span.RecordError(err)
+	return err
 }
 
 func (r *Runner) Wait() {
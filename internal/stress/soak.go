@@ -0,0 +1,343 @@
+package stress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"kasm-stress-test/internal/config"
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/sink"
+	"kasm-stress-test/internal/stats"
+	"kasm-stress-test/internal/tracing"
+	"kasm-stress-test/internal/utils"
+)
+
+// soakRetryDelay is how long a soak run waits before refilling a slot whose
+// session failed to start, so an unavailable deployment isn't hammered
+const soakRetryDelay = 30 * time.Second
+
+// SoakOptions controls a soak run
+type SoakOptions struct {
+	// Duration is how long sessions are kept live for
+	Duration time.Duration
+	// ChurnPerHour is the number of sessions destroyed and replaced every
+	// hour, zero disables churn
+	ChurnPerHour float64
+	// WorkloadInterval is how often the workload is rerun on every live
+	// session, zero runs it only when a session starts
+	WorkloadInterval time.Duration
+	// SampleInterval is how often a time-series sample is recorded
+	SampleInterval time.Duration
+}
+
+// NewSoakOptions creates the soak options set in cfg
+func NewSoakOptions(cfg *config.Config) SoakOptions {
+	return SoakOptions{
+		Duration:         time.Duration(cfg.SoakDurationSeconds) * time.Second,
+		ChurnPerHour:     cfg.SoakChurnPerHour,
+		WorkloadInterval: time.Duration(cfg.SoakWorkloadIntervalSeconds) * time.Second,
+		SampleInterval:   time.Duration(cfg.SoakSampleIntervalSeconds) * time.Second,
+	}
+}
+
+// soakSession is a session kept live by a soak run
+type soakSession struct {
+	kasmID    string
+	number    int
+	startedAt time.Time
+}
+
+// soakSampler accumulates the sample for the current interval
+type soakSampler struct {
+	sample     models.SoakSample
+	startTimes []float64
+}
+
+func (s *soakSampler) finish(now time.Time, live int) models.SoakSample {
+	sample := s.sample
+	sample.Time = now
+	sample.LiveSessions = live
+	if len(s.startTimes) > 0 {
+		sample.MeanTimeToRunning = time.Duration(stats.Mean(s.startTimes) * float64(time.Second))
+		sample.P95TimeToRunning = time.Duration(stats.Percentile(s.startTimes, 95) * float64(time.Second))
+	}
+	*s = soakSampler{}
+	return sample
+}
+
+// Soak keeps the runner's number of sessions live until opts.Duration has
+// passed since the soak started, a delayed group joining late. Failed
+// and churned sessions are replaced, the workload is rerun on a schedule and
+// a time-series sample is recorded every opts.SampleInterval. Sessions still
+// live at the end are left for DestroyAllSessions.
+//
+// Sessions are reported to callback by the slot they occupy rather than by
+// session number, so the display stays the size of the target.
+func (r *Runner) Soak(ctx context.Context, opts SoakOptions, callback func(sessionNumber int, status string, duration time.Duration)) *models.StressTestResult {
+	r.statusCallback = callback
+	r.wg.Add(1)
+	defer r.wg.Done()
+	// Every group finishes at the same time, however late it starts
+	deadline := time.Now().Add(opts.Duration)
+	result := &models.StressTestResult{
+		Username: r.username,
+		Group:    r.group,
+	}
+	r.result = result
+	ctx = utils.ContextWithLogger(ctx, r.log)
+
+	if !time.Now().Add(r.startDelay).Before(deadline) {
+		r.log.Warn("Not starting the sessions of %s, the soak is over before their start delay of %s", r.username, r.startDelay)
+		for i := 0; i < r.sessionNum.Value; i++ {
+			r.statusCallback(i, "Skipped", 0)
+		}
+		return result
+	}
+	if err := r.waitToStart(ctx); err != nil {
+		result.Aborted = true
+		return result
+	}
+	// The schedule of a delayed group starts when it joins
+	startTime := time.Now()
+
+	user, err := r.client.GetUserInfo(ctx, r.username)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to get user info: %v", err))
+		return result
+	}
+	r.UserID = user.UserID
+	r.startKeepalive(ctx)
+
+	slots := make([]*soakSession, r.sessionNum.Value)
+	sampler := &soakSampler{}
+	number := 0
+
+	var churnInterval time.Duration
+	if opts.ChurnPerHour > 0 {
+		churnInterval = time.Duration(float64(time.Hour) / opts.ChurnPerHour)
+	}
+	nextChurn := startTime.Add(churnInterval)
+	nextWorkload := startTime.Add(opts.WorkloadInterval)
+	nextSample := startTime.Add(opts.SampleInterval)
+	nextFill := startTime
+
+	for ctx.Err() == nil && time.Now().Before(deadline) {
+		// Sessions that expired or disappeared are replaced like failed ones
+		for slot, session := range slots {
+			if session != nil && r.live.isGone(session.kasmID) {
+				r.statusCallback(slot, "Gone", time.Since(session.startedAt))
+				slots[slot] = nil
+			}
+		}
+
+		if !time.Now().Before(nextFill) {
+			failed := false
+			for slot := range slots {
+				if slots[slot] != nil || ctx.Err() != nil || !time.Now().Before(deadline) {
+					continue
+				}
+				number++
+				session, ok := r.startSoakSession(ctx, slot, number, sampler)
+				slots[slot] = session
+				failed = failed || !ok
+			}
+			nextFill = time.Now()
+			if failed {
+				nextFill = nextFill.Add(soakRetryDelay)
+			}
+		}
+
+		now := time.Now()
+		if churnInterval > 0 && !now.Before(nextChurn) {
+			r.churnSoakSession(ctx, slots, sampler)
+			nextChurn = advance(nextChurn, churnInterval, now)
+		}
+		if opts.WorkloadInterval > 0 && !now.Before(nextWorkload) {
+			r.runSoakWorkload(ctx, slots, sampler)
+			nextWorkload = advance(nextWorkload, opts.WorkloadInterval, now)
+		}
+		if !now.Before(nextSample) {
+			r.recordSoakSample(result, sampler.finish(now, occupied(slots)))
+			nextSample = advance(nextSample, opts.SampleInterval, now)
+		}
+
+		wake := earliest(deadline, nextSample)
+		if occupied(slots) < len(slots) {
+			wake = earliest(wake, nextFill)
+		}
+		if churnInterval > 0 {
+			wake = earliest(wake, nextChurn)
+		}
+		if opts.WorkloadInterval > 0 {
+			wake = earliest(wake, nextWorkload)
+		}
+		if sleepUntil(ctx, wake) != nil {
+			result.Aborted = true
+		}
+	}
+
+	// Record the final, possibly partial, interval
+	r.recordSoakSample(result, sampler.finish(time.Now(), occupied(slots)))
+
+	for slot, session := range slots {
+		if session != nil {
+			r.kasmsToDestroy = append(r.kasmsToDestroy, session.kasmID)
+			r.statusCallback(slot, "Soak complete", time.Since(session.startedAt))
+		}
+	}
+
+	result.TotalKasms = len(result.KasmResults)
+	result.TotalDuration = time.Since(startTime)
+	if result.TotalKasms > 0 {
+		result.AverageStartTime /= time.Duration(result.TotalKasms)
+	}
+
+	return result
+}
+
+// startSoakSession starts a session in slot and returns it if it is live
+func (r *Runner) startSoakSession(ctx context.Context, slot, number int, sampler *soakSampler) (*soakSession, bool) {
+	sessionStart := time.Now()
+	sessionCtx, span := tracing.Start(ctx, "kasm_session", tracing.KindInternal,
+		tracing.String("user", r.username),
+		tracing.Int("session_number", number))
+	sessionCtx = utils.ContextWithLogger(sessionCtx, r.log.With("session_number", number))
+	kasmResult := r.createAndTestKasm(sessionCtx, slot, number, r.UserID)
+	if kasmResult.ExecutionError != "" {
+		span.RecordError(errors.New(kasmResult.ExecutionError))
+	}
+	if kasmResult.KasmID != "" {
+		span.SetAttributes(tracing.String("kasm_id", kasmResult.KasmID))
+		r.sessionSpans[kasmResult.KasmID] = span
+	}
+	span.End()
+
+	r.result.KasmResults = append(r.result.KasmResults, kasmResult)
+	r.result.AverageStartTime += kasmResult.StartTime
+	sink.Session(r.username, r.group, r.imageID, kasmResult, sessionStart)
+	r.Breaker.RecordSession(kasmResult.ExecutionError != "")
+	sampler.sample.Started++
+
+	if kasmResult.ExecutionError == "" {
+		r.result.SuccessfulKasms++
+		sampler.startTimes = append(sampler.startTimes, kasmResult.StartTime.Seconds())
+		r.statusCallback(slot, "Live", time.Since(sessionStart))
+		return &soakSession{kasmID: kasmResult.KasmID, number: number, startedAt: sessionStart}, true
+	}
+
+	r.result.FailedKasms++
+	r.result.Errors = append(r.result.Errors, fmt.Sprintf("Kasm %d: %s", number, kasmResult.ExecutionError))
+	sampler.sample.Failed++
+	r.statusCallback(slot, "Failed", time.Since(sessionStart))
+
+	// The slot is refilled, so don't keep a failed session around
+	if kasmResult.KasmID != "" {
+		r.destroySoakSession(ctx, kasmResult.KasmID, sampler)
+	}
+	return nil, false
+}
+
+// churnSoakSession destroys the oldest live session, leaving its slot to be
+// refilled
+func (r *Runner) churnSoakSession(ctx context.Context, slots []*soakSession, sampler *soakSampler) {
+	oldest := -1
+	for slot, session := range slots {
+		if session != nil && (oldest < 0 || session.startedAt.Before(slots[oldest].startedAt)) {
+			oldest = slot
+		}
+	}
+	if oldest < 0 {
+		return
+	}
+	session := slots[oldest]
+	r.log.With("session_number", session.number, "kasm_id", session.kasmID).Info("Churning Kasm %d (%s) for user %s", session.number, session.kasmID, r.username)
+	r.statusCallback(oldest, "Churning", time.Since(session.startedAt))
+	r.destroySoakSession(ctx, session.kasmID, sampler)
+	slots[oldest] = nil
+}
+
+// destroySoakSession destroys a session during a soak run. Sessions that
+// can't be destroyed are retried by DestroyAllSessions.
+func (r *Runner) destroySoakSession(ctx context.Context, kasmID string, sampler *soakSampler) {
+	// Destroy even if the run is being aborted, the Kasm would leak otherwise
+	if err := r.destroyKasm(context.WithoutCancel(ctx), kasmID); err != nil {
+		r.log.With("kasm_id", kasmID).Error("Failed to destroy Kasm %s: %v", kasmID, err)
+		sampler.sample.DestroyFailures++
+		r.kasmsToDestroy = append(r.kasmsToDestroy, kasmID)
+		return
+	}
+	sampler.sample.Destroyed++
+	delete(r.sessionSpans, kasmID)
+	r.live.remove(kasmID)
+}
+
+// runSoakWorkload reruns the workload on every live session
+func (r *Runner) runSoakWorkload(ctx context.Context, slots []*soakSession, sampler *soakSampler) {
+	for slot, session := range slots {
+		if session == nil || ctx.Err() != nil {
+			continue
+		}
+		r.statusCallback(slot, "Running workload", time.Since(session.startedAt))
+		log := r.log.With("session_number", session.number, "kasm_id", session.kasmID)
+		workloadCtx := utils.ContextWithLogger(ctx, log)
+		if sessionSpan, ok := r.sessionSpans[session.kasmID]; ok {
+			workloadCtx = tracing.ContextWithSpan(workloadCtx, sessionSpan)
+		}
+		sampler.sample.WorkloadRuns++
+		if err := r.runWorkload(workloadCtx, session.kasmID, r.UserID); err != nil {
+			log.Error("Workload failed on Kasm %s: %v", session.kasmID, err)
+			sampler.sample.WorkloadFailures++
+			r.result.Errors = append(r.result.Errors, fmt.Sprintf("Kasm %d: workload failed: %v", session.number, err))
+			r.statusCallback(slot, "Workload failed", time.Since(session.startedAt))
+			continue
+		}
+		r.statusCallback(slot, "Live", time.Since(session.startedAt))
+	}
+}
+
+func (r *Runner) recordSoakSample(result *models.StressTestResult, sample models.SoakSample) {
+	result.SoakSamples = append(result.SoakSamples, sample)
+	sink.SoakSample(r.username, sample)
+	r.log.Info("Soak sample for user %s: %d live, %d started, %d failed, %d workload failures",
+		r.username, sample.LiveSessions, sample.Started, sample.Failed, sample.WorkloadFailures)
+}
+
+func occupied(slots []*soakSession) int {
+	live := 0
+	for _, session := range slots {
+		if session != nil {
+			live++
+		}
+	}
+	return live
+}
+
+// advance moves next forward by whole intervals until it is after now,
+// skipping any occurrences that were missed while the runner was busy
+func advance(next time.Time, interval time.Duration, now time.Time) time.Time {
+	for !next.After(now) {
+		next = next.Add(interval)
+	}
+	return next
+}
+
+func earliest(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// sleepUntil waits until t or until ctx is done
+func sleepUntil(ctx context.Context, t time.Time) error {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
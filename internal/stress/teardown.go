@@ -0,0 +1,339 @@
+package stress
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kasm-stress-test/internal/api"
+	"kasm-stress-test/internal/config"
+	"kasm-stress-test/internal/models"
+	"kasm-stress-test/internal/tracing"
+	"kasm-stress-test/internal/utils"
+)
+
+// TeardownOptions controls how the sessions of a run are destroyed
+type TeardownOptions struct {
+	// Workers is the number of sessions destroyed concurrently
+	Workers int
+	// Order is the order sessions are destroyed in, one of the
+	// config.TeardownOrder* constants
+	Order string
+	// Profile paces teardown, one of the config.TeardownProfile* constants.
+	// Duration, Steps, StepPercent and Pause configure the profile.
+	Profile     string
+	Duration    time.Duration
+	Steps       int
+	StepPercent float64
+	Pause       time.Duration
+	// Progress, if set, is called after each session has been destroyed
+	Progress func(done, failed, total int)
+}
+
+// NewTeardownOptions creates the teardown options set in cfg
+func NewTeardownOptions(cfg *config.Config) TeardownOptions {
+	return TeardownOptions{
+		Workers:     cfg.TeardownWorkers,
+		Order:       cfg.TeardownOrder,
+		Profile:     cfg.TeardownProfile,
+		Duration:    time.Duration(cfg.TeardownDurationSeconds) * time.Second,
+		Steps:       cfg.TeardownSteps,
+		StepPercent: cfg.TeardownStepPercent,
+		Pause:       time.Duration(cfg.TeardownPauseSeconds) * time.Second,
+	}
+}
+
+// teardownItem is a session waiting to be destroyed
+type teardownItem struct {
+	runner    *Runner
+	kasmID    string
+	startedAt time.Time
+	serverID  string
+}
+
+// teardownBatch is a number of sessions handed to the workers at an offset
+// from the start of teardown
+type teardownBatch struct {
+	offset time.Duration
+	count  int
+}
+
+// teardownOutcome is the result of destroying a session
+type teardownOutcome struct {
+	item     teardownItem
+	start    time.Time
+	duration time.Duration
+	err      error
+}
+
+// Teardown destroys the sessions of every runner, opts.Workers at a time in
+// opts.Order and paced by opts.Profile, then waits for them to disappear if destruction is verified.
+// Sessions that disappeared before teardown are not destroyed. Each session's
+// teardown is recorded in its result. Once ctx is done the pacing and the
+// verification are cut short, but the remaining sessions are still destroyed.
+func Teardown(ctx context.Context, runners []*Runner, opts TeardownOptions) (*models.TeardownSummary, error) {
+	summary := &models.TeardownSummary{
+		Profile:   opts.Profile,
+		Order:     opts.Order,
+		Workers:   opts.Workers,
+		StartedAt: time.Now(),
+	}
+
+	var items []teardownItem
+	for _, r := range runners {
+		r.stopKeepalive()
+		r.recordGoneSessions()
+		for _, kasmID := range r.kasmsToDestroy {
+			item := teardownItem{runner: r, kasmID: kasmID}
+			if kasmResult := r.kasmResult(kasmID); kasmResult != nil {
+				item.startedAt = kasmResult.StartedAt
+				item.serverID = kasmResult.ServerID
+			}
+			items = append(items, item)
+		}
+		r.kasmsToDestroy = nil
+	}
+	orderTeardown(items, opts.Order)
+	utils.Info("Destroying %d sessions with %d workers in %s order, %s profile", len(items), opts.Workers, opts.Order, opts.Profile)
+
+	// Destroy calls outlive ctx, so an interrupt doesn't leave sessions behind
+	destroyCtx := context.WithoutCancel(ctx)
+	jobs := make(chan teardownItem)
+	outcomes := make(chan teardownOutcome)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				start := time.Now()
+				err := item.runner.destroyKasm(destroyCtx, item.kasmID)
+				outcomes <- teardownOutcome{item: item, start: start, duration: time.Since(start), err: err}
+			}
+		}()
+	}
+	var steps []models.TeardownStep
+	go func() {
+		next := 0
+		for _, batch := range teardownSchedule(len(items), opts) {
+			// Once ctx is done the remaining sessions are handed over at
+			// once, without pacing
+			sleepUntil(ctx, summary.StartedAt.Add(batch.offset))
+			steps = append(steps, models.TeardownStep{
+				Time:      time.Now(),
+				Sessions:  batch.count,
+				Remaining: len(items) - next - batch.count,
+			})
+			utils.Info("Teardown step: destroying %d sessions, %d remaining", batch.count, len(items)-next-batch.count)
+			for _, item := range items[next : next+batch.count] {
+				jobs <- item
+			}
+			next += batch.count
+		}
+		close(jobs)
+		wg.Wait()
+		close(outcomes)
+	}()
+
+	var errors []string
+	destroyed := make(map[*Runner]map[string]time.Time)
+	for outcome := range outcomes {
+		r, kasmID := outcome.item.runner, outcome.item.kasmID
+		if kasmResult := r.kasmResult(kasmID); kasmResult != nil {
+			kasmResult.DestroyStartedAt = &outcome.start
+			kasmResult.DestroyDuration = outcome.duration
+		}
+		if outcome.err != nil {
+			log := r.log.With("kasm_id", kasmID)
+			log.Info("Kasm ID: %s, User ID: %v", kasmID, r.UserID)
+			log.Error("Failed to destroy Kasm %s: %v", kasmID, outcome.err)
+			errors = append(errors, fmt.Sprintf("Failed to destroy Kasm %s: %v", kasmID, outcome.err))
+			if kasmResult := r.kasmResult(kasmID); kasmResult != nil {
+				kasmResult.DestroyError = outcome.err.Error()
+			}
+			if r.result != nil {
+				r.result.DestroyFailures++
+			}
+			summary.Failed++
+		} else {
+			if destroyed[r] == nil {
+				destroyed[r] = make(map[string]time.Time)
+			}
+			destroyed[r][kasmID] = outcome.start
+			summary.Destroyed++
+		}
+		if opts.Progress != nil {
+			opts.Progress(summary.Destroyed+summary.Failed, summary.Failed, len(items))
+		}
+	}
+
+	summary.Steps = steps
+
+	// Each runner's sessions are verified concurrently
+	var verifyMutex sync.Mutex
+	for r, kasms := range destroyed {
+		if !r.config.VerifyDestroy {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.verifyDestroyed(ctx, kasms); err != nil {
+				verifyMutex.Lock()
+				errors = append(errors, err.Error())
+				verifyMutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Teardown is the last use of the runners' clients
+	for _, r := range runners {
+		if r.result != nil {
+			r.result.APITimeouts = r.client.Timeouts()
+		}
+	}
+
+	summary.FinishedAt = time.Now()
+	if len(errors) > 0 {
+		return summary, fmt.Errorf("%s", strings.Join(errors, "; "))
+	}
+	return summary, nil
+}
+
+// teardownSchedule splits n sessions into the batches opts.Profile destroys
+// them in
+func teardownSchedule(n int, opts TeardownOptions) []teardownBatch {
+	if n == 0 {
+		return nil
+	}
+
+	var batches []teardownBatch
+	switch opts.Profile {
+	case config.TeardownProfileRamp:
+		for i := 0; i < n; i++ {
+			batches = append(batches, teardownBatch{offset: spread(opts.Duration, i, n), count: 1})
+		}
+	case config.TeardownProfileStep:
+		steps := min(opts.Steps, n)
+		for i := 0; i < steps; i++ {
+			// Earlier steps take the remainder
+			count := n / steps
+			if i < n%steps {
+				count++
+			}
+			batches = append(batches, teardownBatch{offset: spread(opts.Duration, i, steps), count: count})
+		}
+	case config.TeardownProfilePercent:
+		size := max(1, int(math.Ceil(float64(n)*opts.StepPercent/100)))
+		for i := 0; i*size < n; i++ {
+			batches = append(batches, teardownBatch{offset: time.Duration(i) * opts.Pause, count: min(size, n-i*size)})
+		}
+	default:
+		batches = append(batches, teardownBatch{count: n})
+	}
+	return batches
+}
+
+// spread returns the offset of the i-th of n events spread evenly over
+// duration, with the first at the start and the last at the end
+func spread(duration time.Duration, i, n int) time.Duration {
+	if n <= 1 {
+		return 0
+	}
+	return duration * time.Duration(i) / time.Duration(n-1)
+}
+
+// orderTeardown sorts items into the order they are destroyed in
+func orderTeardown(items []teardownItem, order string) {
+	switch order {
+	case config.TeardownOrderLIFO:
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].startedAt.After(items[j].startedAt)
+		})
+	case config.TeardownOrderRandom:
+		rand.Shuffle(len(items), func(i, j int) {
+			items[i], items[j] = items[j], items[i]
+		})
+	case config.TeardownOrderAgent:
+		perAgent := make(map[string]int)
+		for _, item := range items {
+			perAgent[item.serverID]++
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			a, b := items[i], items[j]
+			if perAgent[a.serverID] != perAgent[b.serverID] {
+				return perAgent[a.serverID] < perAgent[b.serverID]
+			}
+			if a.serverID != b.serverID {
+				return a.serverID < b.serverID
+			}
+			return a.startedAt.Before(b.startedAt)
+		})
+	default:
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].startedAt.Before(items[j].startedAt)
+		})
+	}
+}
+
+// verifyDestroyed polls destroyed sessions until they are gone, recording
+// each session's time to destroyed. destroyed maps each session to the time
+// its destroy call was made. It returns an error listing the sessions that
+// were still present at the destroy timeout.
+func (r *Runner) verifyDestroyed(ctx context.Context, destroyed map[string]time.Time) error {
+	ctx, span := tracing.Start(ctx, "verify_destroyed", tracing.KindInternal,
+		tracing.String("user", r.username),
+		tracing.Int("sessions", len(destroyed)))
+	defer span.End()
+	ctx = utils.ContextWithLogger(ctx, r.log)
+
+	kasmIDs := make([]string, 0, len(destroyed))
+	for kasmID := range destroyed {
+		kasmIDs = append(kasmIDs, kasmID)
+	}
+
+	remaining, err := r.client.WaitForKasmsGone(ctx, kasmIDs, r.UserID, api.NewPollPolicy(r.config), func(kasmID string, lastSeen, goneAt time.Time) {
+		if lastSeen.IsZero() {
+			lastSeen = destroyed[kasmID]
+		}
+		r.log.With("kasm_id", kasmID).Info("Kasm %s was gone %s after it was destroyed", kasmID, goneAt.Sub(destroyed[kasmID]).Round(time.Millisecond))
+		if kasmResult := r.kasmResult(kasmID); kasmResult != nil {
+			kasmResult.TimeToDestroyed = goneAt.Sub(destroyed[kasmID])
+			kasmResult.TimeToDestroyedResolution = goneAt.Sub(lastSeen)
+		}
+	})
+	span.RecordError(err)
+
+	if len(remaining) == 0 {
+		return err
+	}
+	for _, kasmID := range remaining {
+		r.log.With("kasm_id", kasmID).Error("Kasm %s was still present %s after it was destroyed", kasmID, time.Since(destroyed[kasmID]).Round(time.Second))
+		if kasmResult := r.kasmResult(kasmID); kasmResult != nil {
+			kasmResult.StillPresent = true
+		}
+		if r.result != nil {
+			r.result.DestroyFailures++
+		}
+	}
+	return fmt.Errorf("%d destroyed Kasms never disappeared: %v", len(remaining), remaining)
+}
+
+// kasmResult returns the result of the session with kasmID, if there is one
+func (r *Runner) kasmResult(kasmID string) *models.KasmResult {
+	if r.result == nil {
+		return nil
+	}
+	for i := range r.result.KasmResults {
+		if r.result.KasmResults[i].KasmID == kasmID {
+			return &r.result.KasmResults[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package stress
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"kasm-stress-test/internal/config"
+)
+
+func TestTeardownSchedule(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		opts TeardownOptions
+		want []teardownBatch
+	}{
+		{
+			name: "no sessions",
+			n:    0,
+			opts: TeardownOptions{Profile: config.TeardownProfileRamp, Duration: time.Minute},
+		},
+		{
+			name: "burst",
+			n:    5,
+			opts: TeardownOptions{Profile: config.TeardownProfileBurst},
+			want: []teardownBatch{{offset: 0, count: 5}},
+		},
+		{
+			name: "ramp",
+			n:    3,
+			opts: TeardownOptions{Profile: config.TeardownProfileRamp, Duration: time.Minute},
+			want: []teardownBatch{{0, 1}, {30 * time.Second, 1}, {time.Minute, 1}},
+		},
+		{
+			name: "ramp of one",
+			n:    1,
+			opts: TeardownOptions{Profile: config.TeardownProfileRamp, Duration: time.Minute},
+			want: []teardownBatch{{0, 1}},
+		},
+		{
+			name: "step with remainder",
+			n:    10,
+			opts: TeardownOptions{Profile: config.TeardownProfileStep, Duration: 90 * time.Second, Steps: 4},
+			want: []teardownBatch{{0, 3}, {30 * time.Second, 3}, {time.Minute, 2}, {90 * time.Second, 2}},
+		},
+		{
+			name: "more steps than sessions",
+			n:    2,
+			opts: TeardownOptions{Profile: config.TeardownProfileStep, Duration: time.Minute, Steps: 4},
+			want: []teardownBatch{{0, 1}, {time.Minute, 1}},
+		},
+		{
+			name: "percent",
+			n:    10,
+			opts: TeardownOptions{Profile: config.TeardownProfilePercent, StepPercent: 25, Pause: time.Minute},
+			want: []teardownBatch{{0, 3}, {time.Minute, 3}, {2 * time.Minute, 3}, {3 * time.Minute, 1}},
+		},
+		{
+			name: "percent of few sessions",
+			n:    3,
+			opts: TeardownOptions{Profile: config.TeardownProfilePercent, StepPercent: 10, Pause: time.Second},
+			want: []teardownBatch{{0, 1}, {time.Second, 1}, {2 * time.Second, 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := teardownSchedule(tt.n, tt.opts)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("teardownSchedule(%d) = %v, want %v", tt.n, got, tt.want)
+			}
+			total := 0
+			for _, batch := range got {
+				total += batch.count
+			}
+			if total != tt.n {
+				t.Errorf("batches destroy %d sessions, want %d", total, tt.n)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBatchSize is the number of ended spans buffered before they are exported
+const maxBatchSize = 256
+
+// maxQueuedBatches bounds the batches waiting to be exported. Batches that
+// don't fit, e.g. while the collector is unreachable, are dropped.
+const maxQueuedBatches = 20
+
+var (
+	exportMutex  sync.Mutex
+	exportTarget *exporter
+	pending      []*Span
+)
+
+// exporter exports batches of spans in the background, so a slow collector
+// never holds up the runners ending spans
+type exporter struct {
+	file       *os.File
+	url        string
+	httpClient *http.Client
+	resource   []Attribute
+
+	batches chan []*Span
+	done    chan struct{}
+	// err is the first export error and dropped the number of spans lost,
+	// both reported by Shutdown. Guarded by exportMutex.
+	err     error
+	dropped int
+}
+
+// Init enables exporting spans to target, which is either an OTLP/HTTP
+// endpoint such as http://localhost:4318 or a file path. Files receive one
+// OTLP JSON export request per line, the format read by the OpenTelemetry
+// Collector's otlpjsonfile receiver. Requests to an endpoint go through
+// transport, or http.DefaultTransport if it is nil. resource attributes
+// describe the run and are attached to every exported batch. Until Init is
+// called, ended spans are discarded.
+func Init(target string, transport http.RoundTripper, resource ...Attribute) error {
+	e := &exporter{
+		resource: resource,
+		batches:  make(chan []*Span, maxQueuedBatches),
+		done:     make(chan struct{}),
+	}
+
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return fmt.Errorf("invalid OTLP endpoint: %w", err)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/traces"
+		}
+		e.url = u.String()
+		e.httpClient = &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	} else {
+		file, err := os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("could not open trace file: %w", err)
+		}
+		e.file = file
+	}
+	go e.run()
+
+	exportMutex.Lock()
+	exportTarget = e
+	exportMutex.Unlock()
+	return nil
+}
+
+// Shutdown exports any buffered spans, waiting for the batches still queued,
+// and stops exporting. It returns the first error exporting spans.
+func Shutdown() error {
+	exportMutex.Lock()
+	e := exportTarget
+	if e == nil {
+		exportMutex.Unlock()
+		return nil
+	}
+	last := pending
+	pending = nil
+	exportTarget = nil
+	close(e.batches)
+	exportMutex.Unlock()
+
+	<-e.done
+	if len(last) > 0 {
+		if err := e.export(last); err != nil {
+			e.fail(err, len(last))
+		}
+	}
+	err := e.err
+	if err != nil {
+		err = fmt.Errorf("%d spans were not exported: %w", e.dropped, err)
+	}
+	if e.file != nil {
+		if closeErr := e.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func export(span *Span) {
+	exportMutex.Lock()
+	defer exportMutex.Unlock()
+	if exportTarget == nil {
+		return
+	}
+	pending = append(pending, span)
+	if len(pending) < maxBatchSize {
+		return
+	}
+	batch := pending
+	pending = nil
+	select {
+	case exportTarget.batches <- batch:
+	default:
+		exportTarget.fail(fmt.Errorf("trace export is falling behind, %d batches are waiting", maxQueuedBatches), len(batch))
+	}
+}
+
+// fail records spans that couldn't be exported. Must be called with
+// exportMutex held, or once e.run has returned.
+func (e *exporter) fail(err error, spans int) {
+	if e.err == nil {
+		e.err = err
+	}
+	e.dropped += spans
+}
+
+// run exports queued batches until the queue is closed. A batch that fails
+// is dropped, not retried.
+func (e *exporter) run() {
+	defer close(e.done)
+	for batch := range e.batches {
+		if err := e.export(batch); err != nil {
+			exportMutex.Lock()
+			e.fail(err, len(batch))
+			exportMutex.Unlock()
+		}
+	}
+}
+
+// export writes a batch of spans to the file or sends it to the endpoint
+func (e *exporter) export(batch []*Span) error {
+	body, err := json.Marshal(encodeRequest(e.resource, batch))
+	if err != nil {
+		return fmt.Errorf("error marshaling spans: %w", err)
+	}
+
+	if e.file != nil {
+		if _, err := e.file.Write(append(body, '\n')); err != nil {
+			return fmt.Errorf("error writing spans: %w", err)
+		}
+		return nil
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating OTLP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending spans: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("OTLP export failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// The types below are the subset of the OTLP JSON encoding used for export
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+// OTLP status codes
+const (
+	statusOK    = 1
+	statusError = 2
+)
+
+func encodeRequest(resource []Attribute, spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		span.mutex.Lock()
+		s := otlpSpan{
+			TraceID:           hex.EncodeToString(span.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.SpanID[:]),
+			Name:              span.Name,
+			Kind:              int(span.Kind),
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			Attributes:        encodeAttributes(span.Attributes),
+			Status:            otlpStatus{Code: statusOK},
+		}
+		if span.ParentSpanID != [8]byte{} {
+			s.ParentSpanID = hex.EncodeToString(span.ParentSpanID[:])
+		}
+		if span.ErrorMessage != "" {
+			s.Status = otlpStatus{Code: statusError, Message: span.ErrorMessage}
+		}
+		span.mutex.Unlock()
+		encoded = append(encoded, s)
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: encodeAttributes(append([]Attribute{String("service.name", "kasm-stress-test")}, resource...)),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "kasm-stress-test"},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+func encodeAttributes(attrs []Attribute) []otlpAttribute {
+	encoded := make([]otlpAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		var value otlpValue
+		switch v := attr.Value.(type) {
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		encoded = append(encoded, otlpAttribute{Key: attr.Key, Value: value})
+	}
+	return encoded
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"kasm-stress-test/internal/utils"
+)
+
+// SpanKind mirrors the OpenTelemetry span kinds used by this tool
+type SpanKind int
+
+// Span kinds, numbered as in the OTLP protocol
+const (
+	KindInternal SpanKind = 1
+	KindClient   SpanKind = 3
+)
+
+// Attribute is a key/value pair attached to a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Span is a single timed operation within a trace
+type Span struct {
+	mutex        sync.Mutex
+	TraceID      [16]byte
+	SpanID       [8]byte
+	ParentSpanID [8]byte
+	Name         string
+	Kind         SpanKind
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   []Attribute
+	ErrorMessage string
+	ended        bool
+}
+
+type spanKey struct{}
+
+// Start begins a span named name. If ctx already carries a span the new span
+// is its child, otherwise it starts a new trace. The returned context carries
+// the new span.
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		StartTime:  time.Now(),
+		Attributes: attrs,
+	}
+	rand.Read(span.SpanID[:])
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else {
+		rand.Read(span.TraceID[:])
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext returns the span carried by ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan returns a copy of ctx carrying span, so that spans started
+// from it become its children even after span has ended
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// TraceIDString returns the hex encoded trace ID
+func (s *Span) TraceIDString() string {
+	return hex.EncodeToString(s.TraceID[:])
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Attributes = append(s.Attributes, attrs...)
+}
+
+// RecordError marks the span as failed. A nil error is ignored.
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ErrorMessage = utils.Redact(err.Error())
+}
+
+// End finishes the span and hands it to the exporter. Calling End more than
+// once has no effect.
+func (s *Span) End() {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mutex.Unlock()
+
+	export(s)
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is a log file that is rotated once it reaches maxSize bytes:
+// path is renamed to path.1, path.1 to path.2 and so on, keeping maxFiles
+// rotated files. With maxFiles 0 the file is just started over, capping its
+// size. A maxSize of 0 disables rotation.
+type rotatingFile struct {
+	mutex    sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	maxSize  int64
+	maxFiles int
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open appends to the file at f.path, creating it if needed
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			// Rather than losing lines, they keep going to the current file
+			fmt.Fprintf(os.Stderr, "Not rotating %s any more: %v\n", f.path, err)
+			f.maxSize = 0
+			if f.file == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file out of the way and starts a new one. If the
+// files can't be moved the current file is reopened, and the error is
+// returned.
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err == nil {
+		err = f.moveAside()
+	}
+	if openErr := f.open(); openErr != nil {
+		return openErr
+	}
+	if err != nil {
+		return fmt.Errorf("error rotating log file: %w", err)
+	}
+	return nil
+}
+
+// moveAside renames the current and rotated files to make room for a new
+// one, or removes the current file with maxFiles 0. Rotated files that don't
+// exist yet are skipped.
+func (f *rotatingFile) moveAside() error {
+	if f.maxFiles == 0 {
+		return ignoreNotExist(os.Remove(f.path))
+	}
+	if err := ignoreNotExist(os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxFiles))); err != nil {
+		return err
+	}
+	for n := f.maxFiles - 1; n >= 1; n-- {
+		if err := ignoreNotExist(os.Rename(fmt.Sprintf("%s.%d", f.path, n), fmt.Sprintf("%s.%d", f.path, n+1))); err != nil {
+			return err
+		}
+	}
+	return os.Rename(f.path, f.path+".1")
+}
+
+// ignoreNotExist returns err unless it is about a file that doesn't exist
+func ignoreNotExist(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (f *rotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
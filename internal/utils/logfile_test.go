@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readFiles returns the contents of the log file and its rotated files by
+// name, leaving out those that don't exist
+func readFiles(t *testing.T, path string, maxFiles int) map[string]string {
+	t.Helper()
+	contents := make(map[string]string)
+	names := []string{path}
+	for n := 1; n <= maxFiles+1; n++ {
+		names = append(names, fmt.Sprintf("%s.%d", path, n))
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[filepath.Base(name)] = string(data)
+	}
+	return contents
+}
+
+func TestRotatingFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxSize  int64
+		maxFiles int
+		existing string
+		writes   []string
+		want     map[string]string
+	}{
+		{
+			name:     "no rotation",
+			maxSize:  0,
+			maxFiles: 2,
+			writes:   []string{"aaaa\n", "bbbb\n", "cccc\n"},
+			want:     map[string]string{"test.log": "aaaa\nbbbb\ncccc\n"},
+		},
+		{
+			name:     "under the size",
+			maxSize:  10,
+			maxFiles: 2,
+			writes:   []string{"aaaa\n", "bbbb\n"},
+			want:     map[string]string{"test.log": "aaaa\nbbbb\n"},
+		},
+		{
+			name:     "rotated",
+			maxSize:  10,
+			maxFiles: 2,
+			writes:   []string{"aaaa\n", "bbbb\n", "cccc\n"},
+			want:     map[string]string{"test.log": "cccc\n", "test.log.1": "aaaa\nbbbb\n"},
+		},
+		{
+			name:     "oldest files dropped",
+			maxSize:  5,
+			maxFiles: 2,
+			writes:   []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n"},
+			want:     map[string]string{"test.log": "dddd\n", "test.log.1": "cccc\n", "test.log.2": "bbbb\n"},
+		},
+		{
+			name:     "started over without rotated files",
+			maxSize:  5,
+			maxFiles: 0,
+			writes:   []string{"aaaa\n", "bbbb\n", "cccc\n"},
+			want:     map[string]string{"test.log": "cccc\n"},
+		},
+		{
+			name:     "line larger than the size",
+			maxSize:  5,
+			maxFiles: 1,
+			writes:   []string{"a very long line\n", "b\n"},
+			want:     map[string]string{"test.log": "b\n", "test.log.1": "a very long line\n"},
+		},
+		{
+			name:     "appended to an existing file",
+			maxSize:  10,
+			maxFiles: 1,
+			existing: "zzzz\n",
+			writes:   []string{"aaaa\n", "bbbb\n"},
+			want:     map[string]string{"test.log": "bbbb\n", "test.log.1": "zzzz\naaaa\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.log")
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			f, err := openRotatingFile(path, tt.maxSize, tt.maxFiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range tt.writes {
+				if n, err := f.Write([]byte(line)); err != nil || n != len(line) {
+					t.Fatalf("Write(%q) = %d, %v", line, n, err)
+				}
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := readFiles(t, path, tt.maxFiles)
+			if len(got) != len(tt.want) {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+			for name, content := range tt.want {
+				if got[name] != content {
+					t.Errorf("%s = %q, want %q", name, got[name], content)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatingFileClosed(t *testing.T) {
+	f, err := openRotatingFile(filepath.Join(t.TempDir(), "test.log"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err := f.Write([]byte("line\n")); err != os.ErrClosed {
+		t.Errorf("Write() after Close() error = %v, want %v", err, os.ErrClosed)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+// TestRotatingFileRotationError checks that lines keep going to the current
+// file when it can't be rotated
+func TestRotatingFileRotationError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	// A directory in the way of the rotated file can't be removed or replaced
+	if err := os.MkdirAll(filepath.Join(path+".1", "in-the-way"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openRotatingFile(path, 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q) error = %v", line, err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "aaaa\nbbbb\ncccc\n" {
+		t.Errorf("log file = %q, want every line", data)
+	}
+	if f.maxSize != 0 {
+		t.Errorf("maxSize = %d, want rotation to be disabled", f.maxSize)
+	}
+}
@@ -1,75 +1,374 @@
 package utils
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"sync"
+	"time"
 )
 
 var (
-	fileLogger    *log.Logger
-	consoleLogger *log.Logger
-	logFile       *os.File
-	once          sync.Once
+	handler       slog.Handler
+	level         = new(slog.LevelVar)
+	consoleLogger = log.New(os.Stdout, "", 0) // Minimal console output
+	logFile       *rotatingFile
+	// logPath is the file lines are written to, empty when they go to
+	// standard error
+	logPath    string
+	logOptions LogOptions
+	// pending holds the lines logged before a run's own log file is opened,
+	// see StartRunLog
+	pending *bytes.Buffer
+	// runAttrs are added to every line, e.g. the run ID
+	runAttrs []any
 )
 
-// InitLoggers initializes the loggers
-func InitLoggers() error {
-	var initError error
-	once.Do(func() {
-		// Create log file in the same directory as the executable
-		execPath, err := os.Executable()
-		if err != nil {
-			initError = fmt.Errorf("error getting executable path: %w", err)
-			return
-		}
-		logFilePath := filepath.Join(filepath.Dir(execPath), "stress-test.log")
-		logFile, err = os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// LogStderr as LogOptions.File writes lines to standard error only
+const LogStderr = "stderr"
+
+// LogOptions configure where log lines are written and how
+type LogOptions struct {
+	// Level is the lowest level written: debug, info, warn or error
+	Level string
+	// Format is the format of the lines, text or json
+	Format string
+	// Dir holds the log files, the executable's directory when empty
+	Dir string
+	// File is the log file, relative to Dir unless absolute, or LogStderr
+	// to write lines to standard error only
+	File string
+	// PerRun writes each run to its own file in Dir, see StartRunLog
+	PerRun bool
+	// A log file is rotated when it reaches MaxSizeMB, keeping MaxFiles
+	// rotated files. A MaxSizeMB of 0 disables rotation.
+	MaxSizeMB int
+	MaxFiles  int
+}
+
+// InitLoggers initializes the loggers. Lines logged before are dropped. With
+// per-run log files no file is opened until StartRunLog, lines logged until
+// then are held and written to the run's file.
+func InitLoggers(opts LogOptions) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(opts.Level)); err != nil {
+		return fmt.Errorf("unknown log level %q", opts.Level)
+	}
+	switch opts.Format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown log format %q, must be text or json", opts.Format)
+	}
+	level.Set(l)
+	logOptions = opts
+
+	switch {
+	case opts.File == LogStderr:
+		handler = newHandler(os.Stderr, opts.Format)
+		return nil
+	case opts.PerRun:
+		pending = new(bytes.Buffer)
+		handler = newHandler(pending, opts.Format)
+		return nil
+	}
+	return openLog(opts.File)
+}
+
+// StartRunLog adds the run ID to every following line. With per-run log
+// files the following lines go to stress-test-<run ID>.log in the log
+// directory, the run ID starting with the time the run started.
+func StartRunLog(runID string) error {
+	runAttrs = []any{"run_id", runID}
+	if !logOptions.PerRun || logOptions.File == LogStderr {
+		return nil
+	}
+	held := pending
+	pending = nil
+	if err := openLog("stress-test-" + runID + ".log"); err != nil {
+		pending = held
+		return err
+	}
+	if held != nil {
+		logFile.Write(held.Bytes())
+	}
+	return nil
+}
+
+// LogDir returns the directory log files are written to, creating it if
+// needed, and checks that files can be created in it
+func LogDir() (string, error) {
+	dir, err := logDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating log directory: %w", err)
+	}
+	file, err := os.CreateTemp(dir, ".stress-test-*")
+	if err != nil {
+		return "", fmt.Errorf("log directory %s is not writable: %w", dir, err)
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return dir, nil
+}
+
+// logDir returns the log directory, the executable's directory by default
+func logDir() (string, error) {
+	if logOptions.Dir != "" {
+		return logOptions.Dir, nil
+	}
+	execPath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("error getting executable path: %w", err)
+	}
+	return filepath.Dir(execPath), nil
+}
+
+// openLog switches logging to the file name, relative to the log directory
+// unless absolute, creating the directory if needed
+func openLog(name string) error {
+	path := name
+	if !filepath.IsAbs(path) {
+		dir, err := logDir()
 		if err != nil {
-			initError = fmt.Errorf("error opening log file: %w", err)
-			return
+			return err
 		}
+		path = filepath.Join(dir, name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating log directory: %w", err)
+	}
+	file, err := openRotatingFile(path, int64(logOptions.MaxSizeMB)<<20, logOptions.MaxFiles)
+	if err != nil {
+		return fmt.Errorf("error opening log file: %w (set log_dir to a writable directory, or log_file to stderr)", err)
+	}
 
-		fileLogger = log.New(logFile, "", log.Ldate|log.Ltime|log.Lshortfile)
-		consoleLogger = log.New(os.Stdout, "", 0) // Minimal console output
-	})
-	return initError
+	CloseLogFile()
+	logFile, logPath = file, path
+	handler = newHandler(file, logOptions.Format)
+	return nil
+}
+
+// LogPath returns the file lines are written to, empty when they go to
+// standard error
+func LogPath() string {
+	return logPath
+}
+
+// newHandler creates the handler of log lines written to w. Lines record the
+// file and line they were logged from and have secrets redacted.
+func newHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			switch {
+			case a.Key == slog.SourceKey:
+				if source, ok := a.Value.Any().(*slog.Source); ok {
+					a.Value = slog.StringValue(filepath.Base(source.File) + ":" + strconv.Itoa(source.Line))
+				}
+			case a.Value.Kind() == slog.KindString:
+				a.Value = slog.StringValue(Redact(a.Value.String()))
+			case a.Value.Kind() == slog.KindAny:
+				if err, ok := a.Value.Any().(error); ok {
+					a.Value = slog.StringValue(Redact(err.Error()))
+				}
+			}
+			return a
+		},
+	}
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
 }
 
-// CloseLogFile closes the log file
+// CloseLogFile closes the log file. Lines held for a run's log file that was
+// never opened are written to standard error, so they aren't lost.
 func CloseLogFile() {
 	if logFile != nil {
 		logFile.Close()
 	}
+	if pending != nil {
+		os.Stderr.Write(pending.Bytes())
+		pending = nil
+	}
+}
+
+// Logger writes log lines carrying fields such as user, kasm_id,
+// session_number or endpoint. The zero Logger writes lines without fields.
+type Logger struct {
+	attrs []any
+}
+
+// With returns a logger whose lines carry the given key-value pairs in
+// addition to those of l
+func (l Logger) With(args ...any) Logger {
+	attrs := make([]any, 0, len(l.attrs)+len(args))
+	attrs = append(attrs, l.attrs...)
+	return Logger{attrs: append(attrs, args...)}
 }
 
-// Info logs an info message to file and prints a simplified version to console
+// Debug logs a message useful when investigating a problem
+func (l Logger) Debug(format string, v ...interface{}) {
+	l.log(slog.LevelDebug, format, v...)
+}
+
+// Info logs an info message
+func (l Logger) Info(format string, v ...interface{}) {
+	l.log(slog.LevelInfo, format, v...)
+}
+
+// Warn logs a warning
+func (l Logger) Warn(format string, v ...interface{}) {
+	l.log(slog.LevelWarn, format, v...)
+}
+
+// Error logs an error message and prints it to the console
+func (l Logger) Error(format string, v ...interface{}) {
+	l.log(slog.LevelError, format, v...)
+	printError("ERROR", format, v...)
+}
+
+// log writes a line attributed to the caller of the Logger method or
+// package function that called it
+func (l Logger) log(lvl slog.Level, format string, v ...interface{}) {
+	if handler == nil || !handler.Enabled(context.Background(), lvl) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), lvl, Redact(fmt.Sprintf(format, v...)), pcs[0])
+	record.Add(runAttrs...)
+	record.Add(l.attrs...)
+	handler.Handle(context.Background(), record)
+}
+
+// With returns a logger whose lines carry the given key-value pairs
+func With(args ...any) Logger {
+	return Logger{}.With(args...)
+}
+
+type loggerKey struct{}
+
+// ContextWithLogger returns a copy of ctx carrying l, so that code called
+// with it logs the same fields
+func ContextWithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFromContext returns the logger carried by ctx, or one without fields
+func LoggerFromContext(ctx context.Context) Logger {
+	l, _ := ctx.Value(loggerKey{}).(Logger)
+	return l
+}
+
+// Debug logs a message useful when investigating a problem
+func Debug(format string, v ...interface{}) {
+	Logger{}.log(slog.LevelDebug, format, v...)
+}
+
+// Info logs an info message to file
 func Info(format string, v ...interface{}) {
-	message := fmt.Sprintf(format, v...)
-	fileLogger.Printf("INFO: %s", message)
+	Logger{}.log(slog.LevelInfo, format, v...)
+}
+
+// Warn logs a warning to file
+func Warn(format string, v ...interface{}) {
+	Logger{}.log(slog.LevelWarn, format, v...)
 }
 
 // Console prints a message to the console
 func Console(format string, v ...interface{}) {
-	message := fmt.Sprintf(format, v...)
+	message := Redact(fmt.Sprintf(format, v...))
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	endProgressLine()
 	consoleLogger.Print(message)
 }
 
+// progressInterval is how often Progress prints a line when the console
+// isn't a terminal
+const progressInterval = 5 * time.Second
+
+var (
+	// progressMutex guards the console while a progress line is shown
+	progressMutex sync.Mutex
+	lastProgress  time.Time
+	// progressLine is set while a terminal's current line holds progress
+	progressLine bool
+	// stdoutIsTerminal reports whether the console can rewrite its lines
+	stdoutIsTerminal = sync.OnceValue(func() bool {
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	})
+)
+
+// Progress reports the progress of a long operation on the console. On a
+// terminal the message keeps rewriting the current line, which is ended once
+// the operation is done. Otherwise, e.g. when the output goes to a file, the
+// message is printed as a line of its own every progressInterval and once
+// done.
+func Progress(done bool, format string, v ...interface{}) {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	message := Redact(fmt.Sprintf(format, v...))
+	if stdoutIsTerminal() {
+		end := ""
+		if done {
+			end = "\n"
+		}
+		consoleLogger.Writer().Write([]byte("\r\033[K" + message + end))
+		progressLine = !done
+		return
+	}
+	if !done && time.Since(lastProgress) < progressInterval {
+		return
+	}
+	lastProgress = time.Now()
+	consoleLogger.Print(message)
+}
+
+// endProgressLine ends a progress line shown on the terminal so that the
+// next message starts on a line of its own. The caller must hold
+// progressMutex.
+func endProgressLine() {
+	if progressLine {
+		consoleLogger.Writer().Write([]byte("\n"))
+		progressLine = false
+	}
+}
+
 // Error logs an error message to file and console
 func Error(format string, v ...interface{}) {
-	message := fmt.Sprintf(format, v...)
-	fileLogger.Printf("ERROR: %s", message)
-	consoleLogger.Printf("ERROR: %s", message)
-	consoleLogger.Println("See stress-test.log for more info")
+	Logger{}.log(slog.LevelError, format, v...)
+	printError("ERROR", format, v...)
 }
 
 // Fatal logs an error message and then exits the program
 func Fatal(format string, v ...interface{}) {
-	message := fmt.Sprintf(format, v...)
-	fileLogger.Printf("FATAL: %s", message)
-	consoleLogger.Printf("FATAL: %s", message)
-	consoleLogger.Println("See stress-test.log for more info")
+	Logger{}.log(slog.LevelError, format, v...)
+	printError("FATAL", format, v...)
 	os.Exit(1)
 }
+
+// printError prints an error to the console, pointing at the log file for
+// the details
+func printError(prefix, format string, v ...interface{}) {
+	message := Redact(fmt.Sprintf(format, v...))
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	endProgressLine()
+	consoleLogger.Printf("%s: %s", prefix, message)
+	if logPath != "" {
+		consoleLogger.Printf("See %s for more info", logPath)
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPerRunLog(t *testing.T) {
+	dir := t.TempDir()
+	err := InitLoggers(LogOptions{Level: "info", Format: "text", Dir: dir, File: "stress-test.log", PerRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		CloseLogFile()
+		handler, logFile, logPath, runAttrs = nil, nil, "", nil
+	})
+
+	Info("before the run")
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("log directory holds %d files before the run, want none", len(entries))
+	}
+	if err := StartRunLog("20240102-150405-a1b2c3"); err != nil {
+		t.Fatal(err)
+	}
+	Info("during the run")
+	CloseLogFile()
+
+	path := filepath.Join(dir, "stress-test-20240102-150405-a1b2c3.log")
+	if LogPath() != path {
+		t.Errorf("LogPath() = %q, want %q", LogPath(), path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "before the run") || !strings.Contains(lines[1], "during the run") {
+		t.Errorf("run log = %q, want the lines from before and during the run", data)
+	}
+	if !strings.Contains(lines[1], "run_id=20240102-150405-a1b2c3") {
+		t.Errorf("line %q has no run ID", lines[1])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "stress-test.log")); !os.IsNotExist(err) {
+		t.Errorf("stress-test.log was created")
+	}
+}
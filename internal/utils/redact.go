@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redacted replaces secrets in redacted text
+const redacted = "[REDACTED]"
+
+var (
+	secrets      []string
+	secretsMutex sync.RWMutex
+
+	// credentialPattern matches the API credentials in a JSON request body,
+	// should one be echoed back, even when they aren't registered secrets
+	credentialPattern = regexp.MustCompile(`("api_key(?:_secret)?"\s*:\s*")[^"]*(")`)
+)
+
+// RegisterSecret adds secrets that are redacted from logs, errors and reports
+func RegisterSecret(values ...string) {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	for _, value := range values {
+		if value != "" {
+			secrets = append(secrets, value)
+		}
+	}
+}
+
+// Redact replaces every registered secret and API credential in s
+func Redact(s string) string {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return credentialPattern.ReplaceAllString(s, "${1}"+redacted+"${2}")
+}
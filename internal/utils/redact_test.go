@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	saved := secrets
+	secrets = nil
+	t.Cleanup(func() { secrets = saved })
+	RegisterSecret("s3cr3t-key-123", "", "zq")
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "no secret", in: "nothing to hide", want: "nothing to hide"},
+		{name: "secret", in: "auth failed for s3cr3t-key-123", want: "auth failed for [REDACTED]"},
+		{name: "every occurrence", in: "s3cr3t-key-123/s3cr3t-key-123", want: "[REDACTED]/[REDACTED]"},
+		{name: "short secret", in: "zqx", want: "[REDACTED]x"},
+		{
+			name: "credentials in a request body",
+			in:   `{"api_key": "other-key", "api_key_secret":"other-secret", "user": "alice"}`,
+			want: `{"api_key": "[REDACTED]", "api_key_secret":"[REDACTED]", "user": "alice"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.in); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// NewRunID returns an identifier for a stress test run made of the start
+// timestamp and a short random suffix, e.g. 20240102-150405-a1b2c3
+func NewRunID(start time.Time) string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return start.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}